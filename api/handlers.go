@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/darkonie/wikiracer/control"
+	"github.com/darkonie/wikiracer/worker"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 )
@@ -20,13 +21,17 @@ type request struct {
 	DestinationPage string `json:"destination_page"`
 	Comment         string `json:"comment"`
 	Workers         int    `json:"workers"`
-	CrawlMethod     string `json:"crawl_method"`
+
+	control.JobOptions
 }
 
 // response is structure used to send back user status.
 type response struct {
 	ID  string `json:"id"`
 	Msg string `json:"msg"`
+
+	// Suggestions are the titles a user may have meant by a missing page.
+	Suggestions []string `json:"suggestions,omitempty"`
 }
 
 func jobInfoHandler(w http.ResponseWriter, r *http.Request) {
@@ -109,19 +114,39 @@ func jobStartHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := req.JobOptions.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	timeout, err := time.ParseDuration(req.Timeout)
 	if err != nil {
 		logrus.Errorf("error parsing timeout %s. Using default timeout 1 min", req.Timeout)
 		timeout = time.Duration(time.Minute)
 	}
 
-	id, err := jpManager.AddJob(req.StartPage, req.DestinationPage, req.Comment, req.CrawlMethod, timeout, req.Workers)
+	id, err := jpManager.AddJob(r.Context(), req.StartPage, req.DestinationPage, req.Comment, timeout, req.Workers, req.JobOptions)
+	if _, ok := err.(*control.OptionError); ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if titleErr, ok := err.(*control.TitleError); ok {
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode(&response{
+			Msg:         titleErr.Error(),
+			Suggestions: titleErr.Suggestions,
+		}); err != nil {
+			logrus.Errorf("error encoding response: %s", err)
+		}
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	// the job keeps its own timeout clock, it stops while the job is paused.
+	ctx, cancel := context.WithCancel(context.Background())
 	err = jpManager.StartJob(ctx, cancel, id)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -137,6 +162,45 @@ func jobStartHandler(w http.ResponseWriter, r *http.Request) {
 
 }
 
+func cacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	jpManager, ok := jpManagerFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unable to get a job manager from context", http.StatusInternalServerError)
+		return
+	}
+
+	stats, ok := jpManager.CacheStats()
+	if !ok {
+		http.Error(w, "link cache is disabled", http.StatusNotFound)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		logrus.Errorf("error encoding cache stats: %s", err)
+	}
+}
+
+func fetchStatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	jpManager, ok := jpManagerFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unable to get a job manager from context", http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(jpManager.FetchStats()); err != nil {
+		logrus.Errorf("error encoding fetch stats: %s", err)
+	}
+}
+
+func crawlersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(worker.Crawlers()); err != nil {
+		logrus.Errorf("error encoding crawlers: %s", err)
+	}
+}
+
 func jobCancelHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	jpManager, ok := jpManagerFromContext(r.Context())
@@ -162,3 +226,119 @@ func jobCancelHandler(w http.ResponseWriter, r *http.Request) {
 		logrus.Errorf("error cancelling a job %s: %s", id, err)
 	}
 }
+
+// resumeRequest is an optional body of a resume request.
+type resumeRequest struct {
+	// Timeout of the run resumed from a checkpoint, the job timeout by default.
+	// A paused job continues with the rest of its timeout.
+	Timeout string `json:"timeout"`
+}
+
+func jobResumeHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	jpManager, ok := jpManagerFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unable to get a job manager from context", http.StatusInternalServerError)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	if _, ok := jpManager.GetJob(id); !ok {
+		http.Error(w, "job not found "+id, http.StatusBadRequest)
+		return
+	}
+
+	var req resumeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	var timeout time.Duration
+	if req.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(req.Timeout); err != nil {
+			logrus.Errorf("error parsing timeout %s. Using the job timeout", req.Timeout)
+		}
+	}
+
+	// a paused job is unpaused, a stopped job is resumed from its last checkpoint.
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := jpManager.ContinueJob(ctx, cancel, id, timeout); err != nil {
+		cancel()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(&response{
+		ID:  id,
+		Msg: "successfully resumed a job",
+	}); err != nil {
+		logrus.Errorf("error encoding response: %s", err)
+	}
+}
+
+func jobPauseHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	jpManager, ok := jpManagerFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unable to get a job manager from context", http.StatusInternalServerError)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	if err := jpManager.PauseJob(id); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(&response{
+		ID:  id,
+		Msg: "successfully paused a job",
+	}); err != nil {
+		logrus.Errorf("error encoding response: %s", err)
+	}
+}
+
+// purgeRequest is an optional body of a purge request.
+type purgeRequest struct {
+	// OlderThan purges only the jobs which stopped at least that long ago, all stopped jobs by default.
+	OlderThan string `json:"older_than"`
+}
+
+// purgeResponse lists the purged jobs.
+type purgeResponse struct {
+	Purged []string `json:"purged"`
+}
+
+func purgeHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	jpManager, ok := jpManagerFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unable to get a job manager from context", http.StatusInternalServerError)
+		return
+	}
+
+	var req purgeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	var olderThan time.Duration
+	if req.OlderThan != "" {
+		var err error
+		if olderThan, err = time.ParseDuration(req.OlderThan); err != nil {
+			http.Error(w, "invalid older_than "+req.OlderThan, http.StatusBadRequest)
+			return
+		}
+	}
+
+	purged := jpManager.PurgeJobs(olderThan)
+	if purged == nil {
+		purged = []string{}
+	}
+	if err := json.NewEncoder(w).Encode(&purgeResponse{Purged: purged}); err != nil {
+		logrus.Errorf("error encoding response: %s", err)
+	}
+}
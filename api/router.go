@@ -41,6 +41,24 @@ func NewRouter(jpManager *control.JobPoolManager) *mux.Router {
 	// cancel an active job.
 	route.Path("/job/{id}/cancel").Handler(jobMiddleware(jobCancelHandler, jpManager)).Methods("POST")
 
+	// pause a running job, it keeps the search state in memory.
+	route.Path("/job/{id}/pause").Handler(jobMiddleware(jobPauseHandler, jpManager)).Methods("POST")
+
+	// resume a paused job, or a stopped one from its last checkpoint.
+	route.Path("/job/{id}/resume").Handler(jobMiddleware(jobResumeHandler, jpManager)).Methods("POST")
+
+	// remove the stopped jobs from the pool and the job store.
+	route.Path("/admin/purge").Handler(jobMiddleware(purgeHandler, jpManager)).Methods("POST")
+
+	// link cache stats.
+	route.Path("/cache").Handler(jobMiddleware(cacheStatsHandler, jpManager)).Methods("GET")
+
+	// crawler fetch metrics.
+	route.Path("/metrics").Handler(jobMiddleware(fetchStatsHandler, jpManager)).Methods("GET")
+
+	// registered crawl methods with their options.
+	route.Path("/crawlers").HandlerFunc(crawlersHandler).Methods("GET")
+
 	// add debug endpoints
 	debug := router.PathPrefix("/debug").Subrouter()
 	debug.Path("/pprof").HandlerFunc(pprof.Index).Methods("GET")
@@ -71,5 +89,5 @@ func jobsFromRequest(r *http.Request) (map[string]*control.Job, error) {
 		return map[string]*control.Job{jobID: j}, nil
 	}
 
-	return jpManager.Pool, nil
+	return jpManager.Jobs(), nil
 }
@@ -0,0 +1,175 @@
+package control
+
+import (
+	"errors"
+	"time"
+
+	"github.com/darkonie/wikiracer/worker"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultCheckpointInterval is how often a running job search state is saved by default.
+const defaultCheckpointInterval = time.Minute
+
+// ErrNoCheckpoint is returned when a job to resume has no saved search state.
+var ErrNoCheckpoint = errors.New("job has no checkpoint to resume from")
+
+// Snapshot is the search state of a job: the frontier, the visited pages and the parent pointers.
+type Snapshot struct {
+	Time time.Time `json:"time"`
+
+	// Pages are the frontier pages and their ancestors. A page goes after its parent.
+	Pages []SnapshotPage `json:"pages"`
+
+	// Frontier are the pages to fetch in the order they were queued.
+	Frontier []SnapshotItem `json:"frontier"`
+
+	// Visited are the titles of the fetched pages.
+	Visited []string `json:"visited"`
+}
+
+// SnapshotPage is a page of the search tree.
+type SnapshotPage struct {
+	Name  string `json:"name"`
+	Depth int    `json:"depth"`
+
+	// Prev is the index of the parent page in Snapshot.Pages, -1 for the start page.
+	Prev int `json:"prev"`
+
+	// Via is the link followed from the parent page.
+	Via *worker.Anchor `json:"via,omitempty"`
+}
+
+// SnapshotItem is a frontier page with its priority.
+type SnapshotItem struct {
+	Page     int `json:"page"`
+	Priority int `json:"priority"`
+}
+
+// takeSnapshot captures the search state. The pages being fetched are kept in the frontier and
+// left out of the visited pages, so they are fetched again after a restore.
+func takeSnapshot(f *frontier, visit *visitedMap) *Snapshot {
+	f.Lock()
+	visit.Lock()
+	items := f.snapshot()
+	leased := make(map[string]bool, len(f.leased))
+	for page := range f.leased {
+		leased[page.Name] = true
+	}
+
+	visited := make([]string, 0, len(visit.m))
+	for name := range visit.m {
+		if !leased[name] {
+			visited = append(visited, name)
+		}
+	}
+	visit.Unlock()
+	f.Unlock()
+
+	// sort without the locks, the workers keep using the frontier meanwhile.
+	sortItems(items)
+
+	s := &Snapshot{
+		Time:     time.Now(),
+		Frontier: make([]SnapshotItem, 0, len(items)),
+		Visited:  visited,
+	}
+
+	index := make(map[*worker.Page]int)
+	var add func(p *worker.Page) int
+	add = func(p *worker.Page) int {
+		if i, ok := index[p]; ok {
+			return i
+		}
+
+		prev := -1
+		if p.Prev != nil {
+			prev = add(p.Prev)
+		}
+		s.Pages = append(s.Pages, SnapshotPage{Name: p.Name, Depth: p.Depth, Prev: prev, Via: p.Via})
+		index[p] = len(s.Pages) - 1
+		return index[p]
+	}
+
+	for _, item := range items {
+		s.Frontier = append(s.Frontier, SnapshotItem{Page: add(item.page), Priority: item.priority})
+	}
+	return s
+}
+
+// restore returns the frontier and the visited pages of the snapshot.
+func (s *Snapshot) restore() (*frontier, *visitedMap) {
+	pages := make([]*worker.Page, len(s.Pages))
+	for i, sp := range s.Pages {
+		p := &worker.Page{Name: sp.Name, Depth: sp.Depth, Via: sp.Via}
+		if sp.Prev >= 0 && sp.Prev < i {
+			p.Prev = pages[sp.Prev]
+		}
+		pages[i] = p
+	}
+
+	f := newFrontier()
+	for _, item := range s.Frontier {
+		if item.Page >= 0 && item.Page < len(pages) {
+			f.push(pages[item.Page], item.Priority)
+		}
+	}
+
+	visit := &visitedMap{m: make(map[string]bool, len(s.Visited))}
+	for _, name := range s.Visited {
+		visit.visited(name)
+	}
+	return f, visit
+}
+
+// checkpoint saves the search state of a running job to the job store, it is kept in memory
+// if there is no job store or the save failed.
+func (j *Job) checkpoint() {
+	j.Lock()
+	f, visit := j.frontier, j.visit
+	j.Unlock()
+	if f == nil {
+		return
+	}
+
+	s := takeSnapshot(f, visit)
+	saved := false
+	if j.store != nil {
+		if err := j.store.SaveSnapshot(j.id, s); err != nil {
+			logrus.Errorf("unable to save job %s checkpoint: %s", j.id, err)
+		} else {
+			saved = true
+		}
+	}
+
+	j.Lock()
+	j.snapshot = s
+	if saved {
+		j.snapshot = nil
+	}
+	j.CheckpointTime = s.Time
+	j.Unlock()
+}
+
+// lastSnapshot returns the last search state of the job, it is loaded from the job store after a restart.
+func (j *Job) lastSnapshot() (*Snapshot, error) {
+	j.Lock()
+	s := j.snapshot
+	j.Unlock()
+	if s != nil {
+		return s, nil
+	}
+
+	if j.store == nil {
+		return nil, ErrNoCheckpoint
+	}
+
+	s, err := j.store.LoadSnapshot(j.id)
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		return nil, ErrNoCheckpoint
+	}
+	return s, nil
+}
@@ -0,0 +1,120 @@
+package control
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/darkonie/wikiracer/worker"
+)
+
+func TestFrontierOrder(t *testing.T) {
+	f := newFrontier()
+	start := &worker.Page{Name: "Mike Tyson", Depth: 1}
+	f.push(&worker.Page{Name: "Ukraine", Depth: 3}, 3)
+	f.push(start, 1)
+	f.push(&worker.Page{Name: "Boxing", Depth: 2, Prev: start}, 2)
+	f.push(&worker.Page{Name: "Olympic Games", Depth: 2, Prev: start}, 2)
+
+	ctx := context.Background()
+	first, _ := f.pop(ctx)
+	if first.Name != "Mike Tyson" {
+		t.Fatalf("expect the lowest priority first. Got %s", first.Name)
+	}
+
+	// the leased page is kept in a snapshot, the visited one is not.
+	visit := &visitedMap{m: make(map[string]bool)}
+	visit.visited(first.Name)
+	s := takeSnapshot(f, visit)
+	if len(s.Visited) != 0 {
+		t.Fatalf("expect leased page not visited. Got %v", s.Visited)
+	}
+
+	restored, visit := s.restore()
+	var names []string
+	for i := 0; i < 4; i++ {
+		p, _ := restored.pop(ctx)
+		names = append(names, p.Name)
+		if p.Name == "Boxing" && (p.Prev == nil || p.Prev.Name != "Mike Tyson") {
+			t.Fatalf("expect parent pointer restored. Got %+v", p.Prev)
+		}
+	}
+	expected := []string{"Mike Tyson", "Boxing", "Olympic Games", "Ukraine"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expect %v. Got %v", expected, names)
+	}
+	if visit.len() != 0 {
+		t.Fatalf("expect no visited pages. Got %d", visit.len())
+	}
+
+	f.done(first)
+	if s := takeSnapshot(f, visit); len(s.Frontier) != 3 {
+		t.Fatalf("expect released page dropped. Got %+v", s.Frontier)
+	}
+}
+
+func TestJobResume(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		fetched []string
+	)
+	blocked := make(chan struct{})
+	job := NewJob("Mike Tyson", "Ukraine", "", "123", time.Second*5, 10, func() worker.WikiCrawler {
+		return worker.CrawlerFunc(func(ctx context.Context, link string) (*worker.Page, error) {
+			mu.Lock()
+			fetched = append(fetched, link)
+			first := len(fetched) == 3
+			mu.Unlock()
+
+			// the job is stopped while BBB is fetched the first time.
+			if link == "BBB" && first {
+				close(blocked)
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return fakeCrawler{}.Fetch(ctx, link)
+		})
+	})
+
+	if err := job.Resume(context.Background(), func() {}, 0); err != ErrNoCheckpoint {
+		t.Fatalf("expect no checkpoint. Got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	job.Start(ctx, cancel)
+	<-blocked
+	job.Stop(Cancelled)
+
+	if job.CheckpointTime.IsZero() {
+		t.Fatal("expect checkpoint on stop")
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := job.Resume(ctx, cancel, 0); err != nil {
+		t.Fatal(err)
+	}
+	<-ctx.Done()
+
+	job.Lock()
+	expected := "Mike Tyson_AAA_BBB_Ukraine"
+	result, status := strings.Join(titles(job.Path), "_"), job.Status
+	job.Unlock()
+	if result != expected || status != PageFound {
+		t.Fatalf("expect %s found. Got %s, status %d", expected, result, status)
+	}
+
+	// the fetched pages are not fetched again.
+	mu.Lock()
+	defer mu.Unlock()
+	if expected := []string{"Mike Tyson", "AAA", "BBB", "BBB"}; !reflect.DeepEqual(fetched, expected) {
+		t.Fatalf("expect %v fetched. Got %v", expected, fetched)
+	}
+
+	if err := job.Resume(context.Background(), func() {}, 0); err == nil {
+		t.Fatal("expect found job not to resume")
+	}
+}
@@ -0,0 +1,119 @@
+package control
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/darkonie/wikiracer/primitives"
+	"github.com/darkonie/wikiracer/worker"
+)
+
+// DefaultMiddleware is a crawler middleware chain used when none is configured.
+// The cache is outside the breaker, so the cached pages are served while the upstream is failing.
+var DefaultMiddleware = []string{"logging", "dedup", "metrics", "cache", "breaker", "timeout"}
+
+// crawler middleware defaults.
+var (
+	defaultFetchTimeout     = time.Second * 30
+	defaultBreakerThreshold = 20
+	defaultBreakerCooldown  = time.Second * 30
+)
+
+// newCrawlerChain validates the configured middleware names and creates the state
+// shared by all jobs.
+func newCrawlerChain(cfg Config, cache *worker.LinkCache) (*crawlerChain, error) {
+	names := cfg.Middleware
+	if names == nil {
+		names = DefaultMiddleware
+	}
+
+	for _, name := range names {
+		switch name {
+		case "logging", "dedup", "metrics", "timeout", "breaker", "cache", "ratelimit":
+		default:
+			return nil, fmt.Errorf("unknown crawler middleware %q", name)
+		}
+	}
+
+	timeout := cfg.FetchTimeout
+	if timeout == 0 {
+		timeout = defaultFetchTimeout
+	}
+
+	threshold := cfg.BreakerThreshold
+	if threshold == 0 {
+		threshold = defaultBreakerThreshold
+	}
+
+	cooldown := cfg.BreakerCooldown
+	if cooldown == 0 {
+		cooldown = defaultBreakerCooldown
+	}
+
+	return &crawlerChain{
+		names:     names,
+		timeout:   timeout,
+		threshold: threshold,
+		cooldown:  cooldown,
+		cache:     cache,
+		metrics:   &worker.FetchMetrics{},
+		bucket:    primitives.NewTokenBucket(cfg.FetchRate, 1),
+		breakers:  make(map[string]*worker.Breaker),
+		flights:   primitives.NewGroup(),
+	}, nil
+}
+
+// crawlerChain assembles the middlewares around the crawlers.
+type crawlerChain struct {
+	sync.Mutex
+
+	names     []string
+	timeout   time.Duration
+	threshold int
+	cooldown  time.Duration
+
+	cache    *worker.LinkCache
+	metrics  *worker.FetchMetrics
+	bucket   *primitives.TokenBucket
+	breakers map[string]*worker.Breaker
+	flights  *primitives.Group
+}
+
+// breaker returns a circuit breaker for a crawl method, the method's upstream is shared by all jobs.
+func (c *crawlerChain) breaker(method string) *worker.Breaker {
+	c.Lock()
+	defer c.Unlock()
+
+	b, ok := c.breakers[method]
+	if !ok {
+		b = worker.NewBreaker(c.threshold, c.cooldown)
+		c.breakers[method] = b
+	}
+	return b
+}
+
+// middleware returns the configured middlewares for a crawl method and a client profile.
+func (c *crawlerChain) middleware(method, profile string) []worker.Middleware {
+	var m []worker.Middleware
+	for _, name := range c.names {
+		switch name {
+		case "logging":
+			m = append(m, worker.Logging(method))
+		case "dedup":
+			// the fetches of the other client profiles go through other proxies and User-Agents.
+			m = append(m, worker.Dedup(c.flights, method+":"+profile))
+		case "metrics":
+			m = append(m, worker.Metrics(c.metrics))
+		case "timeout":
+			m = append(m, worker.Timeout(c.timeout))
+		case "breaker":
+			m = append(m, worker.CircuitBreaker(c.breaker(method)))
+		case "cache":
+			m = append(m, worker.Cache(c.cache, method))
+		case "ratelimit":
+			m = append(m, worker.RateLimit(c.bucket))
+		}
+	}
+	return m
+}
@@ -0,0 +1,144 @@
+package control
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/darkonie/wikiracer/worker"
+)
+
+// newFrontier returns an empty frontier.
+func newFrontier() *frontier {
+	return &frontier{
+		leased: make(map[*worker.Page]int),
+		notify: make(chan struct{}, 1),
+	}
+}
+
+// frontier is the priority queue of the pages to fetch, the lowest priority first and in
+// the order of push among the equal ones. A popped page is leased until done is called for it,
+// so a snapshot has the pages being fetched too.
+type frontier struct {
+	sync.Mutex
+
+	items  frontierHeap
+	seq    uint64
+	leased map[*worker.Page]int
+	paused bool
+
+	// notify wakes up a waiting pop.
+	notify chan struct{}
+}
+
+type frontierItem struct {
+	page     *worker.Page
+	priority int
+	seq      uint64
+}
+
+// frontierHeap implements heap.Interface.
+type frontierHeap []frontierItem
+
+func (h frontierHeap) Len() int { return len(h) }
+
+func (h frontierHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority < h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h frontierHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *frontierHeap) Push(x interface{}) { *h = append(*h, x.(frontierItem)) }
+
+func (h *frontierHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// push adds a page to fetch.
+func (f *frontier) push(page *worker.Page, priority int) {
+	f.Lock()
+	f.seq++
+	heap.Push(&f.items, frontierItem{page: page, priority: priority, seq: f.seq})
+	f.Unlock()
+	f.wake()
+}
+
+func (f *frontier) wake() {
+	select {
+	case f.notify <- struct{}{}:
+	default:
+	}
+}
+
+// pause makes pop wait until unpause is called.
+func (f *frontier) pause() {
+	f.Lock()
+	f.paused = true
+	f.Unlock()
+}
+
+// unpause lets the waiting pops take the pages.
+func (f *frontier) unpause() {
+	f.Lock()
+	f.paused = false
+	f.Unlock()
+	f.wake()
+}
+
+// pop waits for a page and leases it. It waits while the frontier is paused.
+func (f *frontier) pop(ctx context.Context) (*worker.Page, error) {
+	for {
+		f.Lock()
+		if !f.paused && f.items.Len() > 0 {
+			item := heap.Pop(&f.items).(frontierItem)
+			f.leased[item.page] = item.priority
+			more := f.items.Len() > 0
+			f.Unlock()
+
+			// let the next waiting pop take the rest.
+			if more {
+				f.wake()
+			}
+			return item.page, nil
+		}
+		f.Unlock()
+
+		select {
+		case <-f.notify:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// done releases the lease of a page, it was fetched and its links were pushed or it was dropped.
+func (f *frontier) done(page *worker.Page) {
+	f.Lock()
+	delete(f.leased, page)
+	f.Unlock()
+}
+
+// snapshot returns the leased and the queued pages with their priorities, unordered.
+// Must be called with lock held.
+func (f *frontier) snapshot() []frontierItem {
+	items := make([]frontierItem, 0, len(f.items)+len(f.leased))
+	for page, priority := range f.leased {
+		items = append(items, frontierItem{page: page, priority: priority})
+	}
+	return append(items, f.items...)
+}
+
+// sortItems orders the frontier items as they were pushed, so they are popped in the same order
+// after a restore.
+func sortItems(items []frontierItem) {
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].seq < items[j].seq
+	})
+}
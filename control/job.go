@@ -2,12 +2,12 @@ package control
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
-	"net/http"
+	"fmt"
 	"sync"
 	"time"
 
-	"github.com/darkonie/wikiracer/primitives"
 	"github.com/darkonie/wikiracer/worker"
 	"github.com/sirupsen/logrus"
 )
@@ -24,10 +24,23 @@ const (
 
 	// Unchanged initial job state.
 	Unchanged
+
+	// Interrupted status is used for the jobs which were running when the server stopped.
+	Interrupted
+
+	// Paused status is used when the job workers are paused, the job keeps its search state in memory.
+	Paused
+
+	// Queued status is used when the job waits for the worker budget to run.
+	Queued
 )
 
+// saveInterval is how often a running job is saved to the job store.
+const saveInterval = time.Second * 10
+
 // NewJob returns a new job structure.
-func NewJob(startLink, endLink, comment, id, crawlerType string, timeout time.Duration, workers int, client *http.Client) *Job {
+// newWorker is called to create a crawler for every job worker.
+func NewJob(startLink, endLink, comment, id string, timeout time.Duration, workers int, newWorker func() worker.WikiCrawler) *Job {
 
 	// default to 100 workers
 	jobWorkers := 100
@@ -35,21 +48,22 @@ func NewJob(startLink, endLink, comment, id, crawlerType string, timeout time.Du
 		jobWorkers = workers
 	}
 
-	dequeueChan := make(chan interface{})
 	j := &Job{
-		Status:    Unchanged,
 		Comment:   comment,
 		StartLink: startLink,
 		EndLink:   endLink,
 		Timeout:   timeout.String(),
 		Workers:   jobWorkers,
 
-		dequeueChan: dequeueChan,
-		resultChan:  make(chan *worker.Page),
-		client:      client,
-		cancel:      func() {},
-		id:          id,
+		timeout:            timeout,
+		newWorker:          newWorker,
+		cancel:             func() {},
+		id:                 id,
+		retry:              DefaultRetryPolicy,
+		checkpointInterval: defaultCheckpointInterval,
+		ErrorCounts:        make(map[string]uint64),
 	}
+	j.setStatus(Unchanged)
 
 	d := &JobDuration{
 		t1: &j.StartTime,
@@ -57,37 +71,48 @@ func NewJob(startLink, endLink, comment, id, crawlerType string, timeout time.Du
 	}
 
 	j.Duration = d
-
-	// crawler can be [api, html]
-	if crawlerType == "html" {
-		j.newWorker = func() worker.WikiCrawler {
-			return worker.NewHTMLWikiCrawler(client)
-		}
-	} else {
-		j.newWorker = func() worker.WikiCrawler {
-			return worker.NewAPIWikiCrawler(client)
-		}
-	}
-
 	return j
 }
 
+// StatusChange is a job status transition.
+type StatusChange struct {
+	Status int       `json:"status"`
+	Time   time.Time `json:"time"`
+}
+
 // Job provides control over wikiracing.
 type Job struct {
 	sync.Mutex
 
-	q primitives.Q
+	frontier *frontier
+	visit    *visitedMap
+
+	// snapshot is the last checkpoint of the search state if it is not in the job store.
+	snapshot           *Snapshot
+	checkpointInterval time.Duration
 
-	dequeueChan chan interface{}
-	resultChan chan *worker.Page
-	client      *http.Client
+	// size is the estimated size of a stopped job, see compact.
+	size int64
+
+	// sched admits the job to run and limits its fetches. Nil means no worker budget.
+	sched *scheduler
 
 	newWorker func() worker.WikiCrawler
 
 	cancel context.CancelFunc
-	id     string
+	run    uint64
+
+	// the timeout clock, it runs only while the job is running and not paused.
+	timeout   time.Duration
+	remaining time.Duration
+	resumed   time.Time
+	timer     *time.Timer
+
+	id    string
+	retry RetryPolicy
+	store JobStore
 
-	Path      []string    `json:"path"`
+	Path      []Hop       `json:"path"`
 	IsRunning bool        `json:"is_running"`
 	StartLink string      `json:"start_link"`
 	EndLink   string      `json:"end_link"`
@@ -99,9 +124,32 @@ type Job struct {
 	Errors    []string    `json:"errors"`
 	Workers   int         `json:"workers"`
 
+	// History are the status transitions, the first one is the job creation.
+	History []StatusChange `json:"history"`
+
+	// ErrorCounts counts failed fetch attempts by error kind.
+	ErrorCounts map[string]uint64 `json:"error_counts"`
+
+	JobOptions
+
+	// StartTitle and EndTitle tell how the requested pages were resolved to StartLink and EndLink,
+	// e.g. a redirect was followed. Nil if the crawler does not resolve titles.
+	StartTitle *worker.TitleResolution `json:"start_title,omitempty"`
+	EndTitle   *worker.TitleResolution `json:"end_title,omitempty"`
+
+	// UpdateTime is when the job was saved to the job store last time.
+	UpdateTime time.Time `json:"update_time"`
+
+	// CheckpointTime is when the search state was saved last time, the job can be resumed from it.
+	CheckpointTime time.Time `json:"checkpoint_time,omitempty"`
+
+	// QueuePosition is the place of a queued job in the queue, starting with 1.
+	QueuePosition int `json:"queue_position,omitempty"`
+
 	// stats
 	Duration       *JobDuration `json:"duration"`
 	PagesVisited   uint64       `json:"pages_visited"`
+	PagesSkipped   uint64       `json:"pages_skipped"`
 	Depth          int          `json:"depth"`
 }
 
@@ -113,26 +161,357 @@ func (j *Job) updateJobDepth(page *worker.Page) {
 	}
 }
 
-func (j *Job) addError(err error) {
+// countError accounts a failed fetch attempt. A page disallowed by robots.txt is not a failure.
+func (j *Job) countError(err error) {
+	if worker.IsDisallowed(err) {
+		return
+	}
+
+	j.Lock()
+	defer j.Unlock()
+
+	j.ErrorCounts[worker.ErrorKind(err)]++
+}
+
+// skip accounts a page which is not fetched because robots.txt disallows it.
+func (j *Job) skip(link string) {
+	j.Lock()
+	defer j.Unlock()
+
+	logrus.Debugf("skip %s disallowed by robots.txt", link)
+	j.PagesSkipped++
+}
+
+// addError records a page which could not be fetched.
+func (j *Job) addError(link string, err error) {
+	j.Lock()
+	defer j.Unlock()
+
+	j.Errors = append(j.Errors, fmt.Sprintf("%s: %s", link, err))
+}
+
+// setStatus changes the job status and records the transition. Must be called with lock held.
+func (j *Job) setStatus(status int) {
+	j.Status = status
+	j.History = append(j.History, StatusChange{Status: status, Time: time.Now()})
+}
+
+// save writes the job to the job store, if any.
+func (j *Job) save() {
+	if j.store == nil {
+		return
+	}
+
+	j.Lock()
+	j.UpdateTime = time.Now()
+	j.Unlock()
+
+	if err := j.store.Save(j); err != nil {
+		logrus.Errorf("unable to save job %s: %s", j.id, err)
+	}
+}
+
+// MarshalJSON locks the job so it can be safely encoded while running.
+func (j *Job) MarshalJSON() ([]byte, error) {
+	// jobJSON doesn't inherit MarshalJSON method.
+	type jobJSON Job
+
 	j.Lock()
 	defer j.Unlock()
+	return json.Marshal((*jobJSON)(j))
+}
+
+// UnmarshalJSON decodes a job saved to a job store. Duration is computed from the start and end time.
+func (j *Job) UnmarshalJSON(data []byte) error {
+	type jobJSON Job
+	v := struct {
+		*jobJSON
+		Duration json.RawMessage `json:"duration"`
+	}{jobJSON: (*jobJSON)(j)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
 
-	j.Errors = append(j.Errors, err.Error())
+	j.Duration = &JobDuration{t1: &j.StartTime, t2: &j.EndTime}
+	return nil
 }
 
-// Start a new job
+// Start a new job. The job is cancelled when ctx is done or its timeout is over.
+// The job is queued if the worker budget is saturated.
 func (j *Job) Start(ctx context.Context, cancel context.CancelFunc) error {
+	return j.enqueue(cancel, func() error {
+		return j.launch(ctx, cancel, nil, j.timeout)
+	})
+}
+
+// Resume continues a stopped job from its last checkpoint. The job is cancelled when ctx is done
+// or timeout is over, zero timeout means the job timeout.
+func (j *Job) Resume(ctx context.Context, cancel context.CancelFunc, timeout time.Duration) error {
+	j.Lock()
+	err := j.checkResume()
+	j.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return j.resume(ctx, cancel, timeout)
+}
+
+// Continue unpauses a paused job or resumes a stopped job from its last checkpoint. The status
+// is checked and acted on under one lock, so a job paused or stopped in between is not
+// continued the wrong way. timeout is only used to resume, zero means the job timeout.
+func (j *Job) Continue(ctx context.Context, cancel context.CancelFunc, timeout time.Duration) error {
+	j.Lock()
+	if j.Status == Paused {
+		err := j.queueUnpause()
+		j.Unlock()
+		if err != nil {
+			return err
+		}
+		return j.admitUnpause()
+	}
+
+	err := j.checkResume()
+	j.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return j.resume(ctx, cancel, timeout)
+}
+
+// checkResume returns an error if the job cannot be resumed.
+// Must be called with lock held.
+func (j *Job) checkResume() error {
+	if j.Status == PageFound {
+		return errors.New("job has already found the page")
+	}
+	if j.IsRunning || j.Status == Queued {
+		return errors.New("job is already running")
+	}
+	return nil
+}
+
+// resume enqueues a job checked by checkResume from its last checkpoint.
+func (j *Job) resume(ctx context.Context, cancel context.CancelFunc, timeout time.Duration) error {
+	s, err := j.lastSnapshot()
+	if err != nil {
+		return err
+	}
+
+	if timeout == 0 {
+		timeout = j.timeout
+	}
+
+	return j.enqueue(cancel, func() error {
+		return j.launch(ctx, cancel, s, timeout)
+	})
+}
+
+// enqueue runs start when the scheduler admits the job, right away if there is no scheduler.
+// cancel is called if the job is cancelled while queued.
+func (j *Job) enqueue(cancel context.CancelFunc, start func() error) error {
+	j.Lock()
+	if j.IsRunning || j.Status == Queued {
+		j.Unlock()
+		return errors.New("job is already running")
+	}
+	if j.newWorker == nil {
+		j.Unlock()
+		return errors.New("job crawler is not available")
+	}
+	if j.sched != nil {
+		j.cancel = cancel
+		j.setStatus(Queued)
+	}
+	j.Unlock()
+
+	if j.sched == nil {
+		return start()
+	}
+
+	j.save()
+	return j.sched.admit(j, start)
+}
+
+// launch starts a run of the job.
+func (j *Job) launch(ctx context.Context, cancel context.CancelFunc, s *Snapshot, timeout time.Duration) error {
+	run, err := j.begin(ctx, cancel, s, timeout)
+	if err != nil {
+		return err
+	}
+
+	j.save()
+	go j.watch(ctx, run)
+	return nil
+}
+
+// Pause stops the workers from taking pages off the frontier and stops the timeout clock.
+// The pages being fetched are finished, the search state is kept in memory. A paused job
+// gives its place up to the queued jobs.
+func (j *Job) Pause() error {
+	j.Lock()
+	if !j.IsRunning || j.Status != Running {
+		j.Unlock()
+		return errors.New("job is not running")
+	}
+
+	j.stopClock()
+	j.frontier.pause()
+	j.setStatus(Paused)
+	j.Unlock()
+
+	if j.sched != nil {
+		j.sched.release(j)
+	}
+	j.save()
+	return nil
+}
+
+// Unpause continues a paused job with the rest of its timeout, it is queued if the worker
+// budget is saturated.
+func (j *Job) Unpause() error {
+	j.Lock()
+	err := j.queueUnpause()
+	j.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return j.admitUnpause()
+}
+
+// queueUnpause checks the job is paused and queues it if there is a scheduler.
+// Must be called with lock held.
+func (j *Job) queueUnpause() error {
+	if !j.IsRunning || j.Status != Paused {
+		return errors.New("job is not paused")
+	}
+	if j.sched != nil {
+		j.setStatus(Queued)
+	}
+	return nil
+}
+
+// admitUnpause unpauses a job queued by queueUnpause when the scheduler admits it.
+func (j *Job) admitUnpause() error {
+	if j.sched == nil {
+		return j.unpause()
+	}
+
+	j.save()
+	return j.sched.admit(j, j.unpause)
+}
+
+func (j *Job) unpause() error {
+	j.Lock()
+	if !j.IsRunning || (j.Status != Paused && j.Status != Queued) {
+		j.Unlock()
+		return errors.New("job is not paused")
+	}
+
+	j.startClock(j.run, j.remaining)
+	j.frontier.unpause()
+	j.setStatus(Running)
+	j.Unlock()
+
+	j.save()
+	return nil
+}
+
+// setQueuePosition updates the place of the job in the scheduler queue, 0 if it is not queued.
+func (j *Job) setQueuePosition(position int) {
+	j.Lock()
+	j.QueuePosition = position
+	j.Unlock()
+}
+
+// startClock cancels the run when d of running time is over, zero d means no timeout.
+// Must be called with lock held.
+func (j *Job) startClock(run uint64, d time.Duration) {
+	j.remaining = d
+	j.resumed = time.Now()
+	if d <= 0 {
+		return
+	}
+	j.timer = time.AfterFunc(d, func() {
+		j.stopRun(run, Cancelled)
+	})
+}
+
+// stopClock stops the timeout clock and keeps the rest of the timeout.
+// Must be called with lock held.
+func (j *Job) stopClock() {
+	if j.timer == nil {
+		return
+	}
+	j.timer.Stop()
+	j.timer = nil
+	j.remaining -= time.Since(j.resumed)
+}
+
+// watch saves a running job and its search state from time to time and stops it when ctx is done.
+func (j *Job) watch(ctx context.Context, run uint64) {
+	ticker := time.NewTicker(saveInterval)
+	defer ticker.Stop()
+
+	checkpoint := time.NewTicker(j.checkpointInterval)
+	defer checkpoint.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			j.save()
+		case <-checkpoint.C:
+			j.checkpoint()
+		case <-ctx.Done():
+			// the job is not running anymore if it was stopped.
+			j.stopRun(run, Cancelled)
+			return
+		}
+	}
+}
+
+// begin starts the job workers, from the search state of s if it is not nil, for timeout of running time.
+// It returns the number of the run.
+func (j *Job) begin(ctx context.Context, cancel context.CancelFunc, s *Snapshot, timeout time.Duration) (uint64, error) {
 	j.Lock()
 	defer j.Unlock()
 	if j.IsRunning {
-		return errors.New("job is already running")
+		return 0, errors.New("job is already running")
+	}
+	if j.newWorker == nil {
+		return 0, errors.New("job crawler is not available")
+	}
+	if j.sched != nil && j.Status != Queued {
+		return 0, errors.New("job is not queued")
+	}
+
+	if j.AsOf != nil {
+		ctx = worker.WithAsOf(ctx, *j.AsOf)
 	}
 
+	j.run++
+	run := j.run
 	j.cancel = cancel
-	j.q = primitives.NewPQueue(ctx, j.dequeueChan)
 	j.IsRunning = true
-	j.Status = Running
-	j.StartTime = time.Now()
+	j.setStatus(Running)
+	if s == nil {
+		j.frontier = newFrontier()
+		j.visit = &visitedMap{m: make(map[string]bool)}
+		j.StartTime = time.Now()
+
+		// submit start page.
+		j.frontier.push(&worker.Page{Name: j.StartLink, Depth: 1}, 1)
+	} else {
+		j.frontier, j.visit = s.restore()
+		j.EndTime = time.Time{}
+	}
+	f := j.frontier
+	j.startClock(run, timeout)
+
+	// a channel per run, so a worker of the previous run cannot send to this one.
+	results := make(chan *worker.Page)
 
 	go func() {
 		for {
@@ -140,97 +519,178 @@ func (j *Job) Start(ctx context.Context, cancel context.CancelFunc) error {
 			case <-ctx.Done():
 				return
 
-			case page := <- j.resultChan:
+			case page := <-results:
 				j.updateJobDepth(page)
 				if page.Name == j.EndLink {
 					j.updatePath(page)
-					j.Stop(PageFound)
+					j.stopRun(run, PageFound)
 					return
 				}
 
+				priority := page.Depth + 1
+				if page.Disambiguation {
+					if j.Disambiguation == DisambiguationSkip {
+						f.done(page)
+						continue
+					}
+					if j.Disambiguation == DisambiguationPenalize {
+						priority += disambiguationPenalty
+					}
+				}
+
 				if _, ok := page.Links[j.EndLink]; ok {
-					j.updatePath(&worker.Page{Name:j.EndLink, Prev: page})
-					j.Stop(PageFound)
+					j.updatePath(&worker.Page{Name: j.EndLink, Prev: page, Via: via(page, j.EndLink)})
+					j.stopRun(run, PageFound)
 					return
 				}
 
 				depth := page.Depth + 1
 				for link := range page.Links {
-					newPage := &worker.Page{Name:link, Prev: page, Depth: depth}
-					j.q.Enqueue(newPage, depth)
+					newPage := &worker.Page{Name: link, Prev: page, Depth: depth, Via: via(page, link)}
+					f.push(newPage, priority)
 				}
+
+				// the children keep their anchors, the page doesn't need them anymore.
+				page.Anchors = nil
+				f.done(page)
 			}
 		}
 	}()
 
-	// submit start page.
-	j.q.Enqueue(&worker.Page{Name: j.StartLink}, 1)
-	go j.start(ctx)
-	return nil
+	go j.start(ctx, run, f, j.visit, results)
+	return run, nil
 }
 
-func (j *Job)updatePath(page *worker.Page) {
-	var path []string
-	for p := page; p != nil; p = p.Prev {
-		path = append(path, string(p.Name))
+// Hop is a step of the job path.
+type Hop struct {
+	Title string `json:"title"`
+
+	// Anchor, Section and Context describe the link clicked on the previous page to get here,
+	// they are empty if the crawler does not know them.
+	Anchor  string `json:"anchor,omitempty"`
+	Section string `json:"section,omitempty"`
+	Context string `json:"context,omitempty"`
+
+	// Label is the kind of the edge followed to get here, e.g. Wikidata property P31.
+	Label string `json:"label,omitempty"`
+
+	// Description is a human readable form, e.g. clicked 'Ukraine' in section 'Early life'.
+	Description string `json:"description,omitempty"`
+}
+
+func newHop(p *worker.Page) Hop {
+	hop := Hop{Title: p.Name}
+	if p.Via == nil {
+		return hop
 	}
 
-	// reverse slice of strings in go :)
-	reversePath := func(path []string) []string {
-		for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
-			path[i], path[j] = path[j], path[i]
+	if p.Via.Label != "" {
+		hop.Label = p.Via.Label
+		hop.Description = fmt.Sprintf("followed %s", hop.Label)
+		if p.Via.Text != "" {
+			hop.Description += fmt.Sprintf(" (%s)", p.Via.Text)
 		}
-		return path
+		return hop
 	}
 
-	j.Path = reversePath(path)
+	if p.Via.Text == "" {
+		return hop
+	}
+
+	hop.Anchor = p.Via.Text
+	hop.Section = p.Via.Section
+	hop.Context = p.Via.Context
+	hop.Description = fmt.Sprintf("clicked '%s'", hop.Anchor)
+	if hop.Section != "" {
+		hop.Description += fmt.Sprintf(" in section '%s'", hop.Section)
+	}
+	return hop
 }
 
-func (j *Job) start(ctx context.Context) {
-	visit := &visitedMap{
-		m: make(map[string]bool),
+// via returns the anchor of a link on the page.
+func via(page *worker.Page, link string) *worker.Anchor {
+	a, ok := page.Anchors[link]
+	if !ok {
+		return nil
+	}
+	return &a
+}
+
+func (j *Job) updatePath(page *worker.Page) {
+	var path []Hop
+	for p := page; p != nil; p = p.Prev {
+		path = append(path, newHop(p))
+	}
+
+	// reverse slice of hops in go :)
+	for i, k := 0, len(path)-1; i < k; i, k = i+1, k-1 {
+		path[i], path[k] = path[k], path[i]
 	}
 
-	for i := 0; i < j.Workers; i++ {
+	j.Path = path
+}
+
+func (j *Job) start(ctx context.Context, run uint64, f *frontier, visit *visitedMap, results chan<- *worker.Page) {
+	// the workers over the budget would only wait for the fetch slots.
+	workers := j.Workers
+	if j.sched != nil && j.sched.slots.Size() < workers {
+		workers = j.sched.slots.Size()
+	}
+
+	for i := 0; i < workers; i++ {
 		go func() {
 			w := j.newWorker()
+			if j.sched != nil {
+				w = j.sched.limit(j, w)
+			}
 			for {
-				select {
-				case <-ctx.Done():
+				req, err := f.pop(ctx)
+				if err != nil {
 					return
+				}
 
-				case item := <-j.dequeueChan:
-					j.PagesVisited = visit.len()
-					pair, ok := item.(*primitives.Pair)
-					if !ok {
-						logrus.Errorf("received item is not a Pair. Got %+v", item)
-						break
-					}
+				visited := visit.len()
+				j.Lock()
+				j.PagesVisited = visited
+				j.Unlock()
+				if visit.visited(string(req.Name)) {
+					f.done(req)
+					continue
+				}
 
-					req, ok := pair.Item.(*worker.Page)
-					if !ok {
-						logrus.Errorf("received item is not a string. Got %+v", item)
-						break
+				page, err := j.retry.fetch(ctx, w, req.Name, j.countError)
+				if err != nil {
+					if ctx.Err() != nil {
+						// keep the page leased, it is fetched again after resume.
+						return
 					}
-
-					if visit.visited(string(req.Name)) {
-						continue
+					if worker.IsDisallowed(err) && req.Prev == nil {
+						// nothing can be reached, stop the job and say why. The lease keeps
+						// the start page for a resume, e.g. with robots.txt checks turned off.
+						logrus.Errorf("unable to fetch start page %s: %s", req.Name, err)
+						j.addError(req.Name, err)
+						j.stopRun(run, Cancelled)
+						return
 					}
-
-					page, err := w.Fetch(ctx, req.Name)
-					if err != nil {
-						logrus.Error(err)
+					f.done(req)
+					if worker.IsDisallowed(err) {
+						j.skip(req.Name)
 						continue
 					}
+					logrus.Errorf("unable to fetch %s: %s", req.Name, err)
+					j.addError(req.Name, err)
+					continue
+				}
 
-					req.Depth = pair.Priority
-					req.Links = page.Links
+				req.Links = page.Links
+				req.Anchors = page.Anchors
+				req.Disambiguation = page.Disambiguation
 
-					// make sure we don't block if
-					select {
-					case j.resultChan <- req:
-					case <-time.After(time.Second):
-					}
+				// a fetched page is never dropped, on cancel the lease keeps it for resume.
+				select {
+				case results <- req:
+				case <-ctx.Done():
+					return
 				}
 			}
 		}()
@@ -239,14 +699,43 @@ func (j *Job) start(ctx context.Context) {
 
 // Stop a job in progress
 func (j *Job) Stop(reason int) error {
+	return j.stopRun(0, reason)
+}
+
+// stopRun stops the job if it is still in the run, any run if it is 0. The goroutines of a stopped
+// run use it, so they cannot stop the job resumed meanwhile.
+func (j *Job) stopRun(run uint64, reason int) error {
+	cancel, err := j.stop(run, reason)
+	if err != nil {
+		return err
+	}
+
+	// keep the search state, so the job can be resumed.
+	if reason != PageFound {
+		j.checkpoint()
+	}
+
+	// cancel the last, so the job is up to date and saved when its context is done.
+	j.save()
+	cancel()
+	if j.sched != nil {
+		j.sched.release(j)
+	}
+	j.compact()
+	return nil
+}
+
+func (j *Job) stop(run uint64, reason int) (context.CancelFunc, error) {
 	j.Lock()
 	defer j.Unlock()
-	if !j.IsRunning {
-		return errors.New("job is not running")
+	queued := j.Status == Queued && !j.IsRunning
+	if (!j.IsRunning && !queued) || (run != 0 && run != j.run) {
+		return nil, errors.New("job is not running")
 	}
-	j.cancel()
 	j.IsRunning = false
 	j.EndTime = time.Now()
-	j.Status = reason
-	return nil
+	j.stopClock()
+	j.QueuePosition = 0
+	j.setStatus(reason)
+	return j.cancel, nil
 }
@@ -2,34 +2,39 @@ package control
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
 
+	"github.com/darkonie/wikiracer/fakewiki"
+	"github.com/darkonie/wikiracer/wikigen"
 	"github.com/darkonie/wikiracer/worker"
+	"strings"
+	"sync"
 	"testing"
 	"time"
-	"strings"
 )
 
 type fakeCrawler struct {
-
 }
 
-
 func (f fakeCrawler) Fetch(ctx context.Context, link string) (*worker.Page, error) {
 	switch string(link) {
 	case "Mike Tyson":
 		return &worker.Page{
-			Name: "Mike Tyson",
+			Name:  "Mike Tyson",
 			Links: map[string]bool{"AAA": true},
 		}, nil
 	case "AAA":
 		return &worker.Page{
-			Name: "AAA",
+			Name:  "AAA",
 			Links: map[string]bool{"BBB": true},
 		}, nil
 	case "BBB":
 		return &worker.Page{
-			Name: "BBB",
+			Name:  "BBB",
 			Links: map[string]bool{"Ukraine": true},
 		}, nil
 
@@ -39,14 +44,19 @@ func (f fakeCrawler) Fetch(ctx context.Context, link string) (*worker.Page, erro
 	return nil, fmt.Errorf("%s not found", link)
 }
 
-func TestNewJob(t *testing.T) {
-	job := NewJob("Mike Tyson", "Ukraine", "My comment", "123", "",
-		time.Second, 10, nil)
-
-	// dirty hack
-	job.newWorker = func() worker.WikiCrawler {
-		return &fakeCrawler{}
+func titles(path []Hop) []string {
+	var t []string
+	for _, hop := range path {
+		t = append(t, hop.Title)
 	}
+	return t
+}
+
+func TestNewJob(t *testing.T) {
+	job := NewJob("Mike Tyson", "Ukraine", "My comment", "123",
+		time.Second, 10, func() worker.WikiCrawler {
+			return &fakeCrawler{}
+		})
 
 	ctx, cancel := context.WithCancel(context.Background())
 	job.Start(ctx, cancel)
@@ -57,8 +67,482 @@ func TestNewJob(t *testing.T) {
 	}
 
 	expected := "Mike Tyson_AAA_BBB_Ukraine"
-	result := strings.Join(job.Path, "_")
+	result := strings.Join(titles(job.Path), "_")
 	if result != expected {
 		t.Fatalf("expect %s. Got %s", expected, result)
 	}
-}
\ No newline at end of file
+}
+
+type flakyCrawler struct {
+	fails int
+}
+
+func (f *flakyCrawler) Fetch(ctx context.Context, link string) (*worker.Page, error) {
+	if f.fails > 0 {
+		f.fails--
+		return nil, &worker.StatusError{Code: 503}
+	}
+	return &worker.Page{Name: link}, nil
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+	kinds := map[string]int{}
+	onError := func(err error) {
+		kinds[worker.ErrorKind(err)]++
+	}
+
+	if _, err := policy.fetch(context.Background(), &flakyCrawler{fails: 2}, "AAA", onError); err != nil {
+		t.Fatalf("expect page after 2 transient errors. Got %s", err)
+	}
+
+	if _, err := policy.fetch(context.Background(), &flakyCrawler{fails: 3}, "AAA", onError); err == nil {
+		t.Fatal("expect error after 3 failed attempts")
+	}
+
+	if kinds[worker.ErrKindServerError] != 5 {
+		t.Fatalf("expect 5 server errors. Got %v", kinds)
+	}
+}
+
+func TestJobCircuitOpen(t *testing.T) {
+	breaker := worker.NewBreaker(1, time.Millisecond*100)
+	flaky := &flakyCrawler{fails: 1}
+	var mu sync.Mutex
+	job := NewJob("Mike Tyson", "Ukraine", "", "123", time.Second*5, 10, func() worker.WikiCrawler {
+		return worker.Chain(worker.CrawlerFunc(func(ctx context.Context, link string) (*worker.Page, error) {
+			if link == "AAA" {
+				mu.Lock()
+				_, err := flaky.Fetch(ctx, link)
+				mu.Unlock()
+				if err != nil {
+					return nil, err
+				}
+			}
+			return fakeCrawler{}.Fetch(ctx, link)
+		}), worker.CircuitBreaker(breaker))
+	})
+	job.retry = RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond * 10}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	job.Start(ctx, cancel)
+	<-ctx.Done()
+
+	job.Lock()
+	defer job.Unlock()
+	if job.Status != PageFound || len(job.Errors) != 0 {
+		t.Fatalf("expect page found once the breaker closes. Got status %d, errors %v", job.Status, job.Errors)
+	}
+	if job.ErrorCounts[worker.ErrKindCircuitOpen] != 1 {
+		t.Fatalf("expect the page rejected by the open breaker counted once. Got %v", job.ErrorCounts)
+	}
+}
+
+// raceGraph is a small wiki with a single shortest path from Mike Tyson to Ukraine.
+var raceGraph = fakewiki.MapGraph{
+	"Mike Tyson":    {"Boxing", "New York City"},
+	"Boxing":        {"Olympic Games", "Mike Tyson"},
+	"New York City": {"United States"},
+	"Olympic Games": {"Kiev"},
+	"Kiev":          {"Ukraine"},
+	"United States": {},
+	"Ukraine":       {},
+}
+
+func TestJobRace(t *testing.T) {
+	srv := fakewiki.NewServer(raceGraph, 1)
+	defer srv.Close()
+
+	crawlers := map[string]func(*http.Client) worker.WikiCrawler{
+		"api":  worker.NewAPIWikiCrawler,
+		"html": worker.NewHTMLWikiCrawler,
+	}
+
+	for method, newCrawler := range crawlers {
+		start, end := "Mike Tyson", "Ukraine"
+		if method == "html" {
+			start = "Mike_Tyson"
+		}
+
+		newCrawler := newCrawler
+		job := NewJob(start, end, "", "123", time.Second*5, 10, func() worker.WikiCrawler {
+			return newCrawler(srv.Client())
+		})
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		job.Start(ctx, cancel)
+		<-ctx.Done()
+
+		if job.Status != PageFound {
+			t.Fatalf("%s: expect page found. Got status %d, errors %v", method, job.Status, job.Errors)
+		}
+
+		expected := start + "_Boxing_Olympic Games_Kiev_Ukraine"
+		if method == "html" {
+			expected = "Mike_Tyson_Boxing_Olympic_Games_Kiev_Ukraine"
+		}
+		if result := strings.Join(titles(job.Path), "_"); result != expected {
+			t.Fatalf("%s: expect %s. Got %s", method, expected, result)
+		}
+
+		if hop := job.Path[2]; method == "html" && hop.Description != "clicked 'Olympic Games' in section 'Related pages'" {
+			t.Fatalf("unexpected hop %+v", hop)
+		}
+	}
+}
+
+var (
+	recordRaces = flag.Bool("record", false, "record the replayed fake wiki races to testdata")
+	recordLive  = flag.Bool("record.live", false, "record the replayed live races to testdata from en.wikipedia.org")
+)
+
+// runJob runs a job to the end and returns it.
+func runJob(job *Job) *Job {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	job.Start(ctx, cancel)
+	<-ctx.Done()
+	return job
+}
+
+func TestJobReplay(t *testing.T) {
+	races := []struct {
+		dir        string
+		newCrawler func(*http.Client) worker.WikiCrawler
+		start      string
+		end        string
+		expected   string
+		live       bool
+	}{
+		{"api", worker.NewAPIWikiCrawler, "Mike Tyson", "Ukraine", "Mike Tyson_Boxing_Olympic Games_Kiev_Ukraine", false},
+		{"html", worker.NewHTMLWikiCrawler, "Mike_Tyson", "Ukraine", "Mike_Tyson_Boxing_Olympic_Games_Kiev_Ukraine", false},
+		{"live-api", worker.NewAPIWikiCrawler, "Kyiv", "Ukraine", "Kyiv_Ukraine", true},
+		{"live-html", worker.NewHTMLWikiCrawler, "Kyiv", "Ukraine", "Kyiv_Ukraine", true},
+	}
+
+	for _, race := range races {
+		race := race
+		t.Run(race.dir, func(t *testing.T) {
+			dir := filepath.Join("testdata", "races", race.dir)
+			switch {
+			case race.live && *recordLive:
+				transport, err := worker.NewHTTPTransport(worker.DefaultClientProfile)
+				if err != nil {
+					t.Fatal(err)
+				}
+				recordRace(t, dir, transport, race.newCrawler, race.start, race.end)
+			case !race.live && *recordRaces:
+				srv := fakewiki.NewServer(raceGraph, 1)
+				defer srv.Close()
+				recordRace(t, dir, srv.Client().Transport, race.newCrawler, race.start, race.end)
+			}
+
+			if _, err := os.Stat(dir); race.live && os.IsNotExist(err) {
+				t.Skipf("%s is not recorded, run go test ./control -run TestJobReplay -record.live", dir)
+			}
+			client, err := worker.NewReplayClient(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			newCrawler := race.newCrawler
+			job := runJob(NewJob(race.start, race.end, "", "123", time.Second*5, 10, func() worker.WikiCrawler {
+				return newCrawler(client)
+			}))
+
+			if result := strings.Join(titles(job.Path), "_"); job.Status != PageFound || result != race.expected {
+				t.Fatalf("expect %s. Got %s, status %d, errors %v", race.expected, result, job.Status, job.Errors)
+			}
+		})
+	}
+}
+
+// recordRace captures a race fetched through transport to dir. A single worker fetches every page
+// closer than the destination, so a replay with more workers finds all the pages it needs.
+func recordRace(t *testing.T, dir string, upstream http.RoundTripper, newCrawler func(*http.Client) worker.WikiCrawler, start, end string) {
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	transport, err := worker.NewRecordingTransport(upstream, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{Transport: transport}
+	job := runJob(NewJob(start, end, "", "123", time.Second*5, 1, func() worker.WikiCrawler {
+		return newCrawler(client)
+	}))
+	if job.Status != PageFound {
+		t.Fatalf("expect recorded race to find the page. Got status %d, errors %v", job.Status, job.Errors)
+	}
+}
+
+var benchPages = flag.Int("bench.pages", 100000, "number of pages in a generated graph for benchmarks")
+
+// checkPath makes sure the job path follows the links of the graph.
+func checkPath(t testing.TB, g *wikigen.Graph, path []string) {
+	for i := 1; i < len(path); i++ {
+		links, _ := g.Links(path[i-1])
+		found := false
+		for _, l := range links {
+			if l == path[i] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("%s does not link to %s", path[i-1], path[i])
+		}
+	}
+}
+
+func runGeneratedJob(t testing.TB, g *wikigen.Graph, from, to string, workers int) *Job {
+	job := NewJob(from, to, "", "123", time.Minute, workers, g.Crawler)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	job.Start(ctx, cancel)
+	<-ctx.Done()
+
+	if job.Status != PageFound {
+		t.Fatalf("expect page found. Got status %d", job.Status)
+	}
+	checkPath(t, g, titles(job.Path))
+	return job
+}
+
+func TestJobGroundTruth(t *testing.T) {
+	g := wikigen.New(wikigen.Options{Pages: 10000, Degree: 8, Shape: wikigen.PowerLaw, Seed: 42})
+	from, to := g.Plant(5)
+
+	job := runGeneratedJob(t, g, from, to, 100)
+	if len(job.Path)-1 != 5 {
+		t.Fatalf("expect distance 5. Got path %v", job.Path)
+	}
+
+	// a single worker fetches the pages in the order of their depth, so the first path found
+	// is a shortest one. Concurrent workers may report a longer path.
+	from, to = wikigen.Title(1), wikigen.Title(9999)
+	job = runGeneratedJob(t, g, from, to, 1)
+	if d := g.Distance(from, to); len(job.Path)-1 != d {
+		t.Fatalf("expect the shortest distance %d. Got path %v", d, job.Path)
+	}
+}
+
+func BenchmarkJob(b *testing.B) {
+	benchmarkJob(b, *benchPages)
+}
+
+// BenchmarkJobMillion runs a job on a million pages graph, it is skipped with -short.
+func BenchmarkJobMillion(b *testing.B) {
+	if testing.Short() {
+		b.Skip("skipping a million pages benchmark in short mode")
+	}
+	benchmarkJob(b, 1000000)
+}
+
+func benchmarkJob(b *testing.B, pages int) {
+	g := wikigen.New(wikigen.Options{Pages: pages, Degree: 10, Shape: wikigen.PowerLaw, Seed: 42})
+	from, to := g.Plant(6)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		runGeneratedJob(b, g, from, to, 100)
+	}
+}
+
+func TestJobSkipDisambiguation(t *testing.T) {
+	srv := fakewiki.NewServer(fakewiki.MapGraph{
+		"Mike Tyson":               {"Mercury (disambiguation)", "Boxing"},
+		"Mercury (disambiguation)": {"Ukraine"},
+		"Boxing":                   {"Olympic Games"},
+		"Olympic Games":            {"Ukraine"},
+	}, 0)
+	defer srv.Close()
+
+	job := NewJob("Mike Tyson", "Ukraine", "", "123", time.Second*5, 10, func() worker.WikiCrawler {
+		return worker.NewAPIWikiCrawler(srv.Client())
+	})
+	job.Disambiguation = DisambiguationSkip
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	job.Start(ctx, cancel)
+	<-ctx.Done()
+
+	expected := "Mike Tyson_Boxing_Olympic Games_Ukraine"
+	if result := strings.Join(titles(job.Path), "_"); result != expected {
+		t.Fatalf("expect %s. Got %s", expected, result)
+	}
+}
+
+func TestNewHopLabel(t *testing.T) {
+	hop := newHop(&worker.Page{Name: "Q5", Via: &worker.Anchor{Text: "instance of", Label: "P31"}})
+	if hop.Label != "P31" || hop.Description != "followed P31 (instance of)" {
+		t.Fatalf("expect labeled hop. Got %+v", hop)
+	}
+}
+
+func TestJobSkipDisallowed(t *testing.T) {
+	job := NewJob("Mike Tyson", "Ukraine", "", "123", time.Second*5, 10, func() worker.WikiCrawler {
+		return worker.CrawlerFunc(func(ctx context.Context, link string) (*worker.Page, error) {
+			if link == "AAA" {
+				return nil, worker.ErrDisallowed
+			}
+			return fakeCrawler{}.Fetch(ctx, link)
+		})
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	job.Start(ctx, cancel)
+	<-ctx.Done()
+
+	job.Lock()
+	defer job.Unlock()
+	if job.PagesSkipped != 1 || len(job.Errors) != 0 || len(job.ErrorCounts) != 0 {
+		t.Fatalf("expect a skipped page and no errors. Got %d, %v, %v", job.PagesSkipped, job.Errors, job.ErrorCounts)
+	}
+}
+
+func TestJobStartDisallowed(t *testing.T) {
+	job := NewJob("Mike Tyson", "Ukraine", "", "123", time.Second*5, 10, func() worker.WikiCrawler {
+		return worker.CrawlerFunc(func(ctx context.Context, link string) (*worker.Page, error) {
+			return nil, worker.ErrDisallowed
+		})
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	job.Start(ctx, cancel)
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expect the job stopped when the start page is disallowed")
+	}
+
+	job.Lock()
+	defer job.Unlock()
+	if job.Status != Cancelled || len(job.Errors) != 1 || !strings.Contains(job.Errors[0], worker.ErrDisallowed.Error()) {
+		t.Fatalf("expect the job cancelled with the robots.txt error. Got status %d, errors %v", job.Status, job.Errors)
+	}
+}
+
+func TestJobPause(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		fetched []string
+	)
+	fetching, release := make(chan struct{}), make(chan struct{})
+	job := NewJob("Mike Tyson", "Ukraine", "", "123", time.Second, 10, func() worker.WikiCrawler {
+		return worker.CrawlerFunc(func(ctx context.Context, link string) (*worker.Page, error) {
+			mu.Lock()
+			fetched = append(fetched, link)
+			mu.Unlock()
+
+			if link == "AAA" {
+				close(fetching)
+				<-release
+			}
+			return fakeCrawler{}.Fetch(ctx, link)
+		})
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	job.Start(ctx, cancel)
+	<-fetching
+	if err := job.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+
+	// the page being fetched is finished, its links are not fetched and the timeout clock stands still.
+	time.Sleep(time.Second * 2)
+	job.Lock()
+	status := job.Status
+	job.Unlock()
+	mu.Lock()
+	pausedFetches := strings.Join(fetched, "_")
+	mu.Unlock()
+	if status != Paused || pausedFetches != "Mike Tyson_AAA" {
+		t.Fatalf("expect paused job. Got status %d, fetched %s", status, pausedFetches)
+	}
+
+	if err := job.Unpause(); err != nil {
+		t.Fatal(err)
+	}
+	<-ctx.Done()
+
+	job.Lock()
+	defer job.Unlock()
+	expected := "Mike Tyson_AAA_BBB_Ukraine"
+	if result := strings.Join(titles(job.Path), "_"); result != expected || job.Status != PageFound {
+		t.Fatalf("expect %s found. Got %s, status %d", expected, result, job.Status)
+	}
+}
+
+func TestJobContinue(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		fetched []string
+	)
+	fetching, release, blocked := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	job := NewJob("Mike Tyson", "Ukraine", "", "123", time.Second*5, 10, func() worker.WikiCrawler {
+		return worker.CrawlerFunc(func(ctx context.Context, link string) (*worker.Page, error) {
+			mu.Lock()
+			fetched = append(fetched, link)
+			first := len(fetched) == 3
+			mu.Unlock()
+
+			switch {
+			case link == "AAA":
+				close(fetching)
+				<-release
+			// the job is stopped while BBB is fetched the first time.
+			case link == "BBB" && first:
+				close(blocked)
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return fakeCrawler{}.Fetch(ctx, link)
+		})
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	job.Start(ctx, cancel)
+	<-fetching
+	if err := job.Continue(context.Background(), func() {}, 0); err == nil {
+		t.Fatal("expect running job not to continue")
+	}
+
+	// a paused job is unpaused.
+	if err := job.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	if err := job.Continue(context.Background(), func() {}, 0); err != nil {
+		t.Fatal(err)
+	}
+	<-blocked
+	job.Stop(Cancelled)
+
+	// a stopped job is resumed from its checkpoint.
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := job.Continue(ctx, cancel, 0); err != nil {
+		t.Fatal(err)
+	}
+	<-ctx.Done()
+
+	job.Lock()
+	expected := "Mike Tyson_AAA_BBB_Ukraine"
+	result, status := strings.Join(titles(job.Path), "_"), job.Status
+	job.Unlock()
+	if result != expected || status != PageFound {
+		t.Fatalf("expect %s found. Got %s, status %d", expected, result, status)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if expected, result := "Mike Tyson_AAA_BBB_BBB", strings.Join(fetched, "_"); result != expected {
+		t.Fatalf("expect %s fetched. Got %s", expected, result)
+	}
+}
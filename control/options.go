@@ -0,0 +1,140 @@
+package control
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/darkonie/wikiracer/worker"
+)
+
+// disambiguation page policies.
+const (
+	// DisambiguationTraverse follows the links of disambiguation pages as any other.
+	DisambiguationTraverse = "traverse"
+
+	// DisambiguationPenalize follows the links of disambiguation pages with lower priority.
+	DisambiguationPenalize = "penalize"
+
+	// DisambiguationSkip never follows the links of disambiguation pages.
+	DisambiguationSkip = "skip"
+)
+
+// disambiguationPenalty is added to the priority of links found on disambiguation pages.
+const disambiguationPenalty = 2
+
+// JobOptions are optional job settings.
+type JobOptions struct {
+	// Disambiguation is a policy for disambiguation pages: traverse, penalize or skip. Default traverse.
+	Disambiguation string `json:"disambiguation"`
+
+	// AsOf makes the job read the page revisions which were current at that time. Nil means live pages.
+	AsOf *time.Time `json:"as_of,omitempty"`
+
+	// ClientProfile is a name of the configured http client profile to fetch the pages with. Default "default".
+	ClientProfile string `json:"client_profile,omitempty"`
+
+	// CrawlMethod is a name of the registered crawler to fetch the pages with. Default "api".
+	CrawlMethod string `json:"crawl_method"`
+
+	// CrawlOptions are the crawler options, see the crawler options schema.
+	CrawlOptions map[string]string `json:"crawl_options,omitempty"`
+
+	// Categories restrict the race to the pages in any of these categories, e.g. Category:Physics.
+	Categories []string `json:"categories,omitempty"`
+
+	// CategoryDepth is how many levels of subcategories of Categories are allowed too.
+	CategoryDepth int `json:"category_depth,omitempty"`
+}
+
+// DefaultCrawlMethod is used by jobs which do not pick a crawl method.
+const DefaultCrawlMethod = "api"
+
+// OptionError is returned when a job option refers to something the server does not have,
+// e.g. an unknown client profile.
+type OptionError struct {
+	Option string
+	Value  string
+}
+
+func (e *OptionError) Error() string {
+	return fmt.Sprintf("unknown %s %q", e.Option, e.Value)
+}
+
+// Validate returns an error if the options are invalid.
+func (o *JobOptions) Validate() error {
+	switch o.Disambiguation {
+	case "", DisambiguationTraverse, DisambiguationPenalize, DisambiguationSkip:
+	default:
+		return fmt.Errorf("unknown disambiguation policy %q", o.Disambiguation)
+	}
+
+	if o.AsOf != nil && o.AsOf.After(time.Now()) {
+		return fmt.Errorf("as_of %s is in the future", o.AsOf)
+	}
+
+	if o.CategoryDepth < 0 || o.CategoryDepth > maxCategoryDepth {
+		return fmt.Errorf("category_depth must be between 0 and %d", maxCategoryDepth)
+	}
+
+	_, err := o.crawler()
+	return err
+}
+
+// maxCategoryDepth limits the subcategory levels, the category trees grow fast.
+const maxCategoryDepth = 5
+
+// crawler returns the factory of the crawl method and the crawler options with the defaults applied.
+func (o *JobOptions) crawler() (crawlerFactory, error) {
+	method := o.CrawlMethod
+	if method == "" {
+		method = DefaultCrawlMethod
+	}
+
+	f, ok := worker.Lookup(method)
+	if !ok {
+		return crawlerFactory{}, &OptionError{Option: "crawl_method", Value: method}
+	}
+
+	opts, err := f.Prepare(o.CrawlOptions)
+	if err != nil {
+		return crawlerFactory{}, err
+	}
+
+	return crawlerFactory{
+		Factory: f,
+		method:  method,
+		key:     crawlerKey(method, opts),
+		opts:    opts,
+	}, nil
+}
+
+// crawlerFactory is a crawl method factory with the job crawler options.
+type crawlerFactory struct {
+	worker.Factory
+
+	method string
+	key    string
+	opts   worker.Options
+}
+
+// crawlerKey identifies the upstream of a crawler, e.g. to separate the cached pages
+// and the circuit breakers of the crawlers configured with different options. The options
+// must be prepared, so the defaults and the spellings of the same value give the same key.
+func crawlerKey(method string, opts map[string]string) string {
+	if len(opts) == 0 {
+		return method
+	}
+
+	names := make([]string, 0, len(opts))
+	for name := range opts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	key := method
+	for _, name := range names {
+		key += "," + name + "=" + opts[name]
+	}
+	return key
+}
@@ -2,25 +2,223 @@ package control
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"sync"
 	"time"
 
+	"github.com/darkonie/wikiracer/worker"
 	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
 )
 
+// Config is a server wide configuration shared by all jobs.
+type Config struct {
+	// Limits throttle the requests to upstream hosts.
+	Limits worker.LimitConfig
+
+	// Retry describes how failed page fetches are repeated.
+	Retry RetryPolicy
+
+	// Cache is an on disk link cache shared by all jobs. Empty Cache.Dir disables caching.
+	Cache worker.CacheConfig
+
+	// RecordDir is a directory to save every upstream exchange to as fixtures.
+	RecordDir string
+
+	// ReplayDir is a directory with recorded fixtures to serve instead of the upstream.
+	ReplayDir string
+
+	// Transport replaces the http transport of the client profiles, e.g. with a fake wiki in tests.
+	Transport http.RoundTripper
+
+	// Middleware is a list of crawler middlewares wrapped around every crawler, the first one
+	// is the outermost. Could be logging, dedup, metrics, timeout, breaker, cache, ratelimit.
+	// Nil means DefaultMiddleware.
+	Middleware []string
+
+	// FetchTimeout limits a single page fetch in timeout middleware.
+	FetchTimeout time.Duration
+
+	// BreakerThreshold is the number of consecutive transient errors which opens the circuit breaker.
+	BreakerThreshold int
+
+	// BreakerCooldown is how long the circuit breaker stays open.
+	BreakerCooldown time.Duration
+
+	// FetchRate is the number of page fetches per second allowed by ratelimit middleware.
+	FetchRate float64
+
+	// Clients are named http client profiles jobs can pick from. The "default" profile is used
+	// when a job does not pick one, the empty fields of the others are taken from it.
+	Clients map[string]worker.ClientProfile
+
+	// Store persists the jobs, they are loaded from it on start. Nil keeps the jobs in memory only.
+	Store JobStore
+
+	// IgnoreRobots disables robots.txt checks of the HTML crawlers.
+	IgnoreRobots bool
+
+	// RobotsTTL is how long a robots.txt is cached. Zero means a day.
+	RobotsTTL time.Duration
+
+	// CheckpointInterval is how often the search state of a running job is saved. Zero means a minute.
+	CheckpointInterval time.Duration
+
+	// Retention limits the finished jobs kept. Zero value keeps all of them.
+	Retention RetentionPolicy
+
+	// MaxWorkers is the number of concurrent page fetches of all jobs, shared fairly between the
+	// running jobs. Zero means no limit.
+	MaxWorkers int
+
+	// MinJobWorkers is the smallest share of MaxWorkers a running job gets, the jobs which would
+	// get less are queued. Zero means 10.
+	MinJobWorkers int
+}
+
+// DefaultClientProfile is the name of the client profile used by jobs which do not pick one.
+const DefaultClientProfile = "default"
+
 // NewJobPoolManager creates a new instance of JobPoolManager.
-func NewJobPoolManager() *JobPoolManager {
-	return &JobPoolManager{
-		Pool: make(map[string]*Job),
-		client: &http.Client{
-			//Timeout: time.Second*10,
-			Transport: &http.Transport{
-			//TLSHandshakeTimeout: time.Second*10,
-			},
-		},
+func NewJobPoolManager(cfg Config) (*JobPoolManager, error) {
+	var cache *worker.LinkCache
+	if cfg.Cache.Dir != "" {
+		var err error
+		cache, err = worker.NewLinkCache(cfg.Cache)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	envs, err := newEnvs(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := newCrawlerChain(cfg, cache)
+	if err != nil {
+		return nil, err
+	}
+
+	jp := &JobPoolManager{
+		Pool:  make(map[string]*Job),
+		cfg:   cfg,
+		envs:  envs,
+		cache: cache,
+		chain: chain,
+
+		categories: make(map[string]*worker.CategoryIndex),
+	}
+	if cfg.MaxWorkers > 0 {
+		jp.sched = newScheduler(cfg.MaxWorkers, cfg.MinJobWorkers)
 	}
+
+	if cfg.Store != nil {
+		jobs, err := cfg.Store.Load()
+		if err != nil {
+			return nil, fmt.Errorf("unable to load jobs: %s", err)
+		}
+		for id, job := range jobs {
+			restoreJob(id, job, cfg.Store)
+			jp.setup(job)
+
+			// the job can be resumed if its crawl method is still available.
+			if f, err := job.JobOptions.crawler(); err != nil {
+				logrus.Errorf("job %s cannot be resumed: %s", id, err)
+			} else if env, ok := envs[job.ClientProfile]; !ok {
+				logrus.Errorf("job %s cannot be resumed: no client profile %s", id, job.ClientProfile)
+			} else {
+				job.newWorker = jp.jobCrawler(f, env, job.JobOptions, job.EndLink)
+			}
+			jp.Pool[id] = job
+		}
+	}
+
+	if cfg.Retention.enabled() {
+		jp.Evict()
+		go jp.retain()
+	}
+	return jp, nil
+}
+
+// newEnvs builds a crawler environment with an http client for every configured profile.
+// All of them share the upstream limits, the robots.txt cache and the fixtures.
+func newEnvs(cfg Config) (map[string]worker.Env, error) {
+	// a replayed race makes no upstream exchanges to record.
+	if cfg.RecordDir != "" && cfg.ReplayDir != "" {
+		return nil, errors.New("record dir and replay dir cannot be used together")
+	}
+
+	def := cfg.Clients[DefaultClientProfile].WithDefaults(worker.DefaultClientProfile)
+	limiter := worker.NewHostLimiter(cfg.Limits)
+
+	// replayed races do not touch the upstream, no need to limit them.
+	var replay http.RoundTripper
+	if cfg.ReplayDir != "" {
+		var err error
+		replay, err = worker.NewReplayTransport(cfg.ReplayDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// replayed races do not touch the upstream either, robots.txt is not recorded.
+	var robots *worker.RobotsCache
+	if !cfg.IgnoreRobots && replay == nil {
+		robots = worker.NewRobotsCache(cfg.RobotsTTL)
+	}
+
+	envs := map[string]worker.Env{}
+	profiles := map[string]worker.ClientProfile{DefaultClientProfile: def}
+	for name, p := range cfg.Clients {
+		profiles[name] = p.WithDefaults(def)
+	}
+
+	for name, p := range profiles {
+		transport := replay
+		if transport == nil {
+			var err error
+			transport, err = newTransport(cfg, p, limiter)
+			if err != nil {
+				return nil, fmt.Errorf("client profile %s: %s", name, err)
+			}
+		}
+
+		client, err := worker.NewHTTPClient(p, transport)
+		if err != nil {
+			return nil, fmt.Errorf("client profile %s: %s", name, err)
+		}
+		envs[name] = worker.Env{
+			Client:    client,
+			UserAgent: p.UserAgent,
+			Robots:    robots,
+		}
+	}
+	return envs, nil
+}
+
+// newTransport builds the round tripper of a client profile.
+func newTransport(cfg Config, p worker.ClientProfile, limiter *worker.HostLimiter) (http.RoundTripper, error) {
+	var err error
+	transport := cfg.Transport
+	if transport == nil {
+		transport, err = worker.NewHTTPTransport(p)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.RecordDir != "" {
+		transport, err = worker.NewRecordingTransport(transport, cfg.RecordDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return worker.NewLimitedTransport(transport, limiter), nil
 }
 
 // JobPoolManager represents a pool of jobs.
@@ -29,11 +227,61 @@ type JobPoolManager struct {
 
 	Pool map[string]*Job `json:"pool"`
 
-	client *http.Client
+	cfg   Config
+	envs  map[string]worker.Env
+	cache *worker.LinkCache
+	chain *crawlerChain
+	sched *scheduler
+
+	categories map[string]*worker.CategoryIndex
 }
 
-// AddJob adds a new job to a pool.
-func (jp *JobPoolManager) AddJob(startLink, endLink, comment, crawlerType string, timeout time.Duration, workers int) (string, error) {
+// defaultWikiHost is the MediaWiki site of the crawlers without host option.
+const defaultWikiHost = "en.wikipedia.org"
+
+// AddJob adds a new job to a pool. The start and destination pages are resolved first, a missing
+// one is reported with TitleError.
+func (jp *JobPoolManager) AddJob(ctx context.Context, startLink, endLink, comment string, timeout time.Duration, workers int, opts JobOptions) (string, error) {
+	if err := opts.Validate(); err != nil {
+		return "", err
+	}
+
+	crawler, err := opts.crawler()
+	if err != nil {
+		return "", err
+	}
+	opts.CrawlMethod = crawler.method
+	if crawler.Normalize != nil {
+		startLink, endLink = crawler.Normalize(crawler.opts, startLink), crawler.Normalize(crawler.opts, endLink)
+	}
+
+	if opts.ClientProfile == "" {
+		opts.ClientProfile = DefaultClientProfile
+	}
+	env, ok := jp.envs[opts.ClientProfile]
+	if !ok {
+		return "", &OptionError{Option: "client_profile", Value: opts.ClientProfile}
+	}
+
+	start, err := resolveTitle(ctx, crawler, env, opts, "start_page", startLink)
+	if err != nil {
+		return "", err
+	}
+	if start != nil {
+		startLink = start.Title
+	}
+
+	end, err := resolveTitle(ctx, crawler, env, opts, "destination_page", endLink)
+	if err != nil {
+		return "", err
+	}
+	if end != nil {
+		endLink = end.Title
+	}
+
+	// make room for the new job.
+	jp.Evict()
+
 	jp.Lock()
 	defer jp.Unlock()
 
@@ -42,11 +290,69 @@ func (jp *JobPoolManager) AddJob(startLink, endLink, comment, crawlerType string
 		return "", err
 	}
 
+	job := NewJob(startLink, endLink, comment, id.String(), timeout, workers, jp.jobCrawler(crawler, env, opts, endLink))
+	if opts.Disambiguation == "" {
+		opts.Disambiguation = DisambiguationTraverse
+	}
+	job.JobOptions = opts
+	job.StartTitle, job.EndTitle = start, end
+	jp.setup(job)
+	job.save()
+
 	// assuming id is unique
-	jp.Pool[id.String()] = NewJob(startLink, endLink, comment, id.String(), crawlerType, timeout, workers, jp.client)
+	jp.Pool[id.String()] = job
 	return id.String(), nil
 }
 
+// setup applies the pool configuration to a job.
+func (jp *JobPoolManager) setup(job *Job) {
+	if jp.cfg.Retry.MaxAttempts > 0 {
+		job.retry = jp.cfg.Retry
+	}
+	if jp.cfg.CheckpointInterval > 0 {
+		job.checkpointInterval = jp.cfg.CheckpointInterval
+	}
+	job.store = jp.cfg.Store
+	job.sched = jp.sched
+}
+
+// jobCrawler returns a function which creates the crawlers of a job, filtered by its categories if any.
+// Must be called with lock held.
+func (jp *JobPoolManager) jobCrawler(f crawlerFactory, env worker.Env, opts JobOptions, endLink string) func() worker.WikiCrawler {
+	var filters []worker.Middleware
+	if len(opts.Categories) > 0 {
+		index := jp.categoryIndex(opts.ClientProfile, f.opts.String("host"), env.Client)
+		filters = append(filters, worker.CategoryFilter(index, opts.Categories, opts.CategoryDepth, endLink))
+	}
+	return jp.newCrawler(f, env, opts.ClientProfile, filters...)
+}
+
+// newCrawler returns a function which creates crawlers of the crawl method wrapped in the
+// configured middleware chain. The job filters are wrapped around the chain, so the cached
+// pages are not filtered.
+func (jp *JobPoolManager) newCrawler(f crawlerFactory, env worker.Env, profile string, filters ...worker.Middleware) func() worker.WikiCrawler {
+	middleware := append(filters, jp.chain.middleware(f.key, profile)...)
+	return func() worker.WikiCrawler {
+		return worker.Chain(f.New(env, f.opts), middleware...)
+	}
+}
+
+// categoryIndex returns the category index of a MediaWiki site shared by the jobs with the same client profile.
+// Must be called with lock held.
+func (jp *JobPoolManager) categoryIndex(profile, host string, client *http.Client) *worker.CategoryIndex {
+	if host == "" {
+		host = defaultWikiHost
+	}
+
+	key := profile + ":" + host
+	index, ok := jp.categories[key]
+	if !ok {
+		index = worker.NewCategoryIndex(client, url.URL{Scheme: "https", Host: host}, jp.cache)
+		jp.categories[key] = index
+	}
+	return index
+}
+
 // GetJob returns a job from a pool.
 func (jp *JobPoolManager) GetJob(id string) (*Job, bool) {
 	jp.RLock()
@@ -55,6 +361,17 @@ func (jp *JobPoolManager) GetJob(id string) (*Job, bool) {
 	return j, ok
 }
 
+// Jobs returns a copy of the pool.
+func (jp *JobPoolManager) Jobs() map[string]*Job {
+	jp.RLock()
+	defer jp.RUnlock()
+	jobs := make(map[string]*Job, len(jp.Pool))
+	for id, job := range jp.Pool {
+		jobs[id] = job
+	}
+	return jobs
+}
+
 // StartJob starts a job from a pool.
 func (jp *JobPoolManager) StartJob(ctx context.Context, cancel context.CancelFunc, id string) error {
 	job, ok := jp.GetJob(id)
@@ -64,3 +381,49 @@ func (jp *JobPoolManager) StartJob(ctx context.Context, cancel context.CancelFun
 
 	return job.Start(ctx, cancel)
 }
+
+// ResumeJob continues a stopped job of a pool from its last checkpoint, zero timeout means the job timeout.
+func (jp *JobPoolManager) ResumeJob(ctx context.Context, cancel context.CancelFunc, id string, timeout time.Duration) error {
+	job, ok := jp.GetJob(id)
+	if !ok {
+		return fmt.Errorf("job %s does not exist in the pool", id)
+	}
+
+	return job.Resume(ctx, cancel, timeout)
+}
+
+// ContinueJob unpauses a paused job of a pool or resumes a stopped one from its last checkpoint,
+// zero timeout means the job timeout. The timeout is not used for a paused job.
+func (jp *JobPoolManager) ContinueJob(ctx context.Context, cancel context.CancelFunc, id string, timeout time.Duration) error {
+	job, ok := jp.GetJob(id)
+	if !ok {
+		return fmt.Errorf("job %s does not exist in the pool", id)
+	}
+
+	return job.Continue(ctx, cancel, timeout)
+}
+
+// PauseJob pauses a running job of a pool.
+func (jp *JobPoolManager) PauseJob(id string) error {
+	job, ok := jp.GetJob(id)
+	if !ok {
+		return fmt.Errorf("job %s does not exist in the pool", id)
+	}
+
+	return job.Pause()
+}
+
+// CacheStats returns the link cache stats and false if caching is disabled.
+func (jp *JobPoolManager) CacheStats() (worker.CacheStats, bool) {
+	if jp.cache == nil {
+		return worker.CacheStats{}, false
+	}
+	return jp.cache.Stats(), true
+}
+
+// FetchStats returns the fetch metrics of all jobs.
+func (jp *JobPoolManager) FetchStats() worker.FetchStats {
+	stats := jp.chain.metrics.Stats()
+	_, stats.Deduplicated = jp.chain.flights.Stats()
+	return stats
+}
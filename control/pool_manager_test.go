@@ -0,0 +1,217 @@
+package control
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/darkonie/wikiracer/fakewiki"
+	"github.com/darkonie/wikiracer/worker"
+)
+
+// newFakeJobPoolManager returns a job pool manager which crawls the fake wiki of graph g.
+func newFakeJobPoolManager(t *testing.T, g fakewiki.Graph) *JobPoolManager {
+	srv := fakewiki.NewServer(g, 0)
+	t.Cleanup(srv.Close)
+
+	jp, err := NewJobPoolManager(Config{Transport: srv.Client().Transport})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jp
+}
+
+func TestAddJobOptions(t *testing.T) {
+	jp := newFakeJobPoolManager(t, fakewiki.MapGraph{"Mike Tyson": {"Ukraine"}, "Ukraine": nil})
+
+	for _, opts := range []JobOptions{
+		{CrawlMethod: "telepathy"},
+		{ClientProfile: "corp"},
+	} {
+		_, err := jp.AddJob(context.Background(), "Mike Tyson", "Ukraine", "", time.Minute, 1, opts)
+		if _, ok := err.(*OptionError); !ok {
+			t.Errorf("expect OptionError for %+v. Got %v", opts, err)
+		}
+	}
+
+	if _, err := jp.AddJob(context.Background(), "Mike Tyson", "Ukraine", "", time.Minute, 1, JobOptions{CrawlOptions: map[string]string{"color": "red"}}); err == nil {
+		t.Error("expect an error for unknown crawler option")
+	}
+
+	id, err := jp.AddJob(context.Background(), "Mike Tyson", "Ukraine", "", time.Minute, 1, JobOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, _ := jp.GetJob(id)
+	if job.CrawlMethod != DefaultCrawlMethod || job.ClientProfile != DefaultClientProfile {
+		t.Fatalf("expect default crawl method and client profile. Got %s, %s", job.CrawlMethod, job.ClientProfile)
+	}
+}
+
+func TestCrawlerKey(t *testing.T) {
+	key := func(opts JobOptions) string {
+		f, err := opts.crawler()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f.key
+	}
+
+	web := key(JobOptions{CrawlMethod: "web"})
+	if k := key(JobOptions{CrawlMethod: "web", CrawlOptions: map[string]string{"keep_query": "0"}}); k != web {
+		t.Fatalf("expect the default options to give key %s. Got %s", web, k)
+	}
+	if k := key(JobOptions{CrawlMethod: "web", CrawlOptions: map[string]string{"keep_query": "true"}}); k == web {
+		t.Fatalf("expect a different key for keep_query. Got %s", k)
+	}
+}
+
+func TestDedupClientProfiles(t *testing.T) {
+	chain, err := newCrawlerChain(Config{Middleware: []string{"dedup"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fetches int32
+	release := make(chan struct{})
+	slow := worker.CrawlerFunc(func(ctx context.Context, link string) (*worker.Page, error) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		return &worker.Page{Name: link}, nil
+	})
+
+	var wg sync.WaitGroup
+	for _, profile := range []string{"default", "corp"} {
+		c := worker.Chain(slow, chain.middleware("api", profile)...)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Fetch(context.Background(), "Mike Tyson")
+		}()
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&fetches) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&fetches); n != 2 {
+		t.Fatalf("expect a fetch per client profile. Got %d", n)
+	}
+}
+
+func TestCacheWhileBreakerOpen(t *testing.T) {
+	cache, err := worker.NewLinkCache(worker.CacheConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err := newCrawlerChain(Config{BreakerThreshold: 1, BreakerCooldown: time.Minute}, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := worker.Chain(worker.CrawlerFunc(func(ctx context.Context, link string) (*worker.Page, error) {
+		if link == "Ukraine" {
+			return nil, &worker.StatusError{Code: 503}
+		}
+		return &worker.Page{Name: link, Links: map[string]bool{"Boxing": true}}, nil
+	}), chain.middleware("api", DefaultClientProfile)...)
+
+	if _, err := c.Fetch(context.Background(), "Mike Tyson"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Fetch(context.Background(), "Ukraine"); err == nil {
+		t.Fatal("expect the upstream error")
+	}
+	if _, err := c.Fetch(context.Background(), "Boxing"); err != worker.ErrCircuitOpen {
+		t.Fatalf("expect the breaker open. Got %v", err)
+	}
+
+	page, err := c.Fetch(context.Background(), "Mike Tyson")
+	if err != nil || !page.Links["Boxing"] {
+		t.Fatalf("expect the cached page while the breaker is open. Got %v, %v", page, err)
+	}
+}
+
+func TestAddJobNormalizeTitles(t *testing.T) {
+	jp := newFakeJobPoolManager(t, fakewiki.CategoryGraph{
+		Graph:   fakewiki.MapGraph{},
+		Parents: map[string][]string{"Category:Physics": {"Category:Mathematics"}},
+	})
+
+	id, err := jp.AddJob(context.Background(), "Physics", "Category:Mathematics", "", time.Minute, 1, JobOptions{CrawlMethod: "category"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, _ := jp.GetJob(id)
+	if job.StartLink != "Category:Physics" || job.EndLink != "Category:Mathematics" {
+		t.Fatalf("expect category titles. Got %s, %s", job.StartLink, job.EndLink)
+	}
+}
+
+func TestAddJobResolveTitles(t *testing.T) {
+	jp := newFakeJobPoolManager(t, fakewiki.RedirectGraph{
+		Graph: fakewiki.MapGraph{
+			"Mike Tyson":               {"Ukraine"},
+			"Ukraine":                  nil,
+			"Ukrainian language":       nil,
+			"Mercury (disambiguation)": {"Ukraine"},
+		},
+		Redirects: map[string]string{"Iron Mike": "Mike Tyson"},
+	})
+
+	id, err := jp.AddJob(context.Background(), "Iron_Mike", "Ukraine", "", time.Minute, 1, JobOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, _ := jp.GetJob(id)
+	if job.StartLink != "Mike Tyson" || job.StartTitle == nil || !job.StartTitle.Redirect || job.StartTitle.Requested != "Iron_Mike" {
+		t.Fatalf("expect redirect resolved to Mike Tyson. Got %s, %+v", job.StartLink, job.StartTitle)
+	}
+
+	id, err = jp.AddJob(context.Background(), "Iron Mike", "Ukraine", "", time.Minute, 1, JobOptions{CrawlMethod: "html"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job, _ := jp.GetJob(id); job.StartLink != "Mike_Tyson" {
+		t.Fatalf("expect html title Mike_Tyson. Got %s", job.StartLink)
+	}
+
+	_, err = jp.AddJob(context.Background(), "Mike Tyson", "Ukrane", "", time.Minute, 1, JobOptions{})
+	titleErr, ok := err.(*TitleError)
+	if !ok || titleErr.Field != "destination_page" || titleErr.Reason != TitleMissing {
+		t.Fatalf("expect missing destination_page. Got %v", err)
+	}
+	if !reflect.DeepEqual(titleErr.Suggestions, []string{"Ukraine"}) {
+		t.Fatalf("expect Ukraine suggested. Got %v", titleErr.Suggestions)
+	}
+
+	_, err = jp.AddJob(context.Background(), "Mike Tyson", "Mercury (disambiguation)", "", time.Minute, 1, JobOptions{Disambiguation: DisambiguationSkip})
+	if titleErr, ok := err.(*TitleError); !ok || titleErr.Reason != TitleAmbiguous {
+		t.Fatalf("expect ambiguous destination_page. Got %v", err)
+	}
+
+	// the pages are not checked against the current wiki when racing through the old revisions.
+	asOf := time.Now().Add(-time.Hour)
+	if _, err := jp.AddJob(context.Background(), "Mike Tyson", "Ukrane", "", time.Minute, 1, JobOptions{AsOf: &asOf}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := jp.AddJob(context.Background(), "Q42", "Q1", "", time.Minute, 1, JobOptions{CrawlMethod: "wikidata"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecordReplayConfig(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewJobPoolManager(Config{RecordDir: dir, ReplayDir: dir}); err == nil {
+		t.Fatal("expect record and replay together to be rejected")
+	}
+}
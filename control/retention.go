@@ -0,0 +1,193 @@
+package control
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// retentionInterval is how often the pool is checked for the finished jobs to evict.
+const retentionInterval = time.Minute
+
+// RetentionPolicy limits the finished jobs kept in the pool and the job store. The running
+// and paused jobs are never evicted, the oldest finished jobs are evicted first.
+type RetentionPolicy struct {
+	// MaxAge is how long a job is kept after it stopped. Zero keeps the jobs forever.
+	MaxAge time.Duration
+
+	// MaxJobs is the number of the finished jobs kept. Zero means no limit.
+	MaxJobs int
+
+	// MaxMemory is the estimated size of the finished jobs kept in bytes. Zero means no limit.
+	MaxMemory int64
+}
+
+func (p RetentionPolicy) enabled() bool {
+	return p.MaxAge > 0 || p.MaxJobs > 0 || p.MaxMemory > 0
+}
+
+// compact drops the search state of a stopped job, so the job is only its summary: the path,
+// the stats and the history. The snapshot is kept if the job could be resumed from memory only.
+func (j *Job) compact() {
+	j.Lock()
+	j.frontier = nil
+	j.visit = nil
+	if j.Status == PageFound {
+		j.snapshot = nil
+	}
+	j.Unlock()
+
+	j.estimateSize()
+}
+
+// estimateSize updates the estimated size of a stopped job with the size of its json.
+func (j *Job) estimateSize() {
+	data, err := json.Marshal(j)
+	if err != nil {
+		logrus.Errorf("unable to estimate job %s size: %s", j.id, err)
+		return
+	}
+
+	j.Lock()
+	j.size = int64(len(data))
+	j.Unlock()
+}
+
+// finished returns when a stopped job stopped, or was created if it never started.
+// A queued job is about to run, it is not finished.
+func (j *Job) finished() (time.Time, bool) {
+	// the scheduler takes the job lock, so check it first.
+	if j.sched != nil && j.sched.holds(j) {
+		return time.Time{}, false
+	}
+
+	j.Lock()
+	defer j.Unlock()
+	if j.IsRunning || j.Status == Queued {
+		return time.Time{}, false
+	}
+	if !j.EndTime.IsZero() {
+		return j.EndTime, true
+	}
+	if len(j.History) > 0 {
+		return j.History[0].Time, true
+	}
+	return j.UpdateTime, true
+}
+
+// retainedJob is a finished job considered for eviction.
+type retainedJob struct {
+	id       string
+	finished time.Time
+	size     int64
+}
+
+// finishedJobs returns the finished jobs of the pool, the oldest first.
+// Must be called with lock held.
+func (jp *JobPoolManager) finishedJobs() []retainedJob {
+	var jobs []retainedJob
+	for id, job := range jp.Pool {
+		t, ok := job.finished()
+		if !ok {
+			continue
+		}
+
+		job.Lock()
+		size := job.size
+		job.Unlock()
+		jobs = append(jobs, retainedJob{id: id, finished: t, size: size})
+	}
+
+	sort.Slice(jobs, func(i, k int) bool {
+		return jobs[i].finished.Before(jobs[k].finished)
+	})
+	return jobs
+}
+
+// Evict removes the finished jobs which are beyond the retention policy from the pool and the job store.
+// It returns the ids of the evicted jobs.
+func (jp *JobPoolManager) Evict() []string {
+	p := jp.cfg.Retention
+	if !p.enabled() {
+		return nil
+	}
+
+	jp.Lock()
+	jobs := jp.finishedJobs()
+	var total int64
+	for _, job := range jobs {
+		total += job.size
+	}
+
+	var ids []string
+	for i, job := range jobs {
+		expired := p.MaxAge > 0 && time.Since(job.finished) > p.MaxAge
+		tooMany := p.MaxJobs > 0 && len(jobs)-i > p.MaxJobs
+		tooBig := p.MaxMemory > 0 && total > p.MaxMemory
+		if !expired && !tooMany && !tooBig {
+			break
+		}
+
+		ids = append(ids, job.id)
+		total -= job.size
+	}
+	jp.remove(ids)
+	jp.Unlock()
+
+	jp.deleteStored(ids)
+	if len(ids) > 0 {
+		logrus.Infof("evicted %d finished jobs", len(ids))
+	}
+	return ids
+}
+
+// PurgeJobs removes the jobs which stopped at least olderThan ago from the pool and the job store.
+// The running and paused jobs are kept, they have to be cancelled first. It returns the ids of the purged jobs.
+func (jp *JobPoolManager) PurgeJobs(olderThan time.Duration) []string {
+	jp.Lock()
+	var ids []string
+	for _, job := range jp.finishedJobs() {
+		if time.Since(job.finished) < olderThan {
+			break
+		}
+		ids = append(ids, job.id)
+	}
+	jp.remove(ids)
+	jp.Unlock()
+
+	jp.deleteStored(ids)
+	return ids
+}
+
+// remove deletes the jobs from the pool.
+// Must be called with lock held.
+func (jp *JobPoolManager) remove(ids []string) {
+	for _, id := range ids {
+		delete(jp.Pool, id)
+	}
+}
+
+// deleteStored deletes the jobs from the job store, so they are not loaded again on restart.
+func (jp *JobPoolManager) deleteStored(ids []string) {
+	if jp.cfg.Store == nil {
+		return
+	}
+
+	for _, id := range ids {
+		if err := jp.cfg.Store.Delete(id); err != nil {
+			logrus.Errorf("unable to delete job %s: %s", id, err)
+		}
+	}
+}
+
+// retain evicts the finished jobs from time to time, e.g. when they get too old.
+func (jp *JobPoolManager) retain() {
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		jp.Evict()
+	}
+}
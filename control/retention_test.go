@@ -0,0 +1,163 @@
+package control
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/darkonie/wikiracer/worker"
+)
+
+func TestJobCompact(t *testing.T) {
+	job := NewJob("Mike Tyson", "Ukraine", "", "123", time.Second*5, 10, func() worker.WikiCrawler {
+		return fakeCrawler{}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	job.Start(ctx, cancel)
+	<-ctx.Done()
+
+	// the job is compacted right after it is cancelled.
+	for i := 0; i < 100; i++ {
+		job.Lock()
+		compacted := job.frontier == nil && job.visit == nil && job.size > 0
+		job.Unlock()
+		if compacted {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	job.Lock()
+	defer job.Unlock()
+	if job.frontier != nil || job.visit != nil || job.snapshot != nil || job.size == 0 {
+		t.Fatalf("expect compacted job. Got %+v", job)
+	}
+	if len(job.Path) != 4 || job.PagesVisited == 0 {
+		t.Fatalf("expect the summary kept. Got %+v", job)
+	}
+}
+
+// finishedJob adds a job stopped ago to a pool.
+func finishedJob(jp *JobPoolManager, id string, ago time.Duration, size int64) {
+	job := NewJob("Mike Tyson", "Ukraine", "", id, time.Minute, 1, nil)
+	job.setStatus(PageFound)
+	job.EndTime = time.Now().Add(-ago)
+	job.size = size
+	job.store = jp.cfg.Store
+	job.save()
+	jp.Pool[id] = job
+}
+
+func poolIDs(jp *JobPoolManager) []string {
+	var ids []string
+	for id := range jp.Jobs() {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestEvict(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jp, err := NewJobPoolManager(Config{Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	finishedJob(jp, "old", time.Hour*3, 100)
+	finishedJob(jp, "older", time.Hour*4, 100)
+	finishedJob(jp, "new", time.Minute, 100)
+	finishedJob(jp, "newer", time.Second, 100)
+
+	// a running job is never evicted.
+	running := NewJob("Mike Tyson", "Ukraine", "", "running", time.Minute, 1, nil)
+	running.IsRunning = true
+	jp.Pool["running"] = running
+
+	// nothing is evicted without a retention policy.
+	if ids := jp.Evict(); len(ids) != 0 {
+		t.Fatalf("expect nothing evicted. Got %v", ids)
+	}
+
+	jp.cfg.Retention = RetentionPolicy{MaxAge: time.Hour * 2}
+	if ids := jp.Evict(); !reflect.DeepEqual(ids, []string{"older", "old"}) {
+		t.Fatalf("expect the expired jobs evicted. Got %v", ids)
+	}
+	jobs, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := jobs["old"]; ok || len(jobs) != 2 {
+		t.Fatalf("expect the evicted jobs deleted from the store. Got %v", jobs)
+	}
+
+	finishedJob(jp, "old", time.Hour, 300)
+	jp.cfg.Retention = RetentionPolicy{MaxJobs: 2}
+	if ids := jp.Evict(); !reflect.DeepEqual(ids, []string{"old"}) {
+		t.Fatalf("expect the oldest job evicted. Got %v", ids)
+	}
+
+	jp.cfg.Retention = RetentionPolicy{MaxMemory: 150}
+	if ids := jp.Evict(); !reflect.DeepEqual(ids, []string{"new"}) {
+		t.Fatalf("expect the oldest job evicted. Got %v", ids)
+	}
+
+	if ids := poolIDs(jp); !reflect.DeepEqual(ids, []string{"newer", "running"}) {
+		t.Fatalf("unexpected pool %v", ids)
+	}
+}
+
+func TestPurgeJobs(t *testing.T) {
+	jp, err := NewJobPoolManager(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	finishedJob(jp, "old", time.Hour, 100)
+	finishedJob(jp, "new", time.Second, 100)
+	running := NewJob("Mike Tyson", "Ukraine", "", "running", time.Minute, 1, nil)
+	running.IsRunning = true
+	jp.Pool["running"] = running
+
+	if ids := jp.PurgeJobs(time.Minute); !reflect.DeepEqual(ids, []string{"old"}) {
+		t.Fatalf("expect the old job purged. Got %v", ids)
+	}
+	if ids := jp.PurgeJobs(0); !reflect.DeepEqual(ids, []string{"new"}) {
+		t.Fatalf("expect the stopped job purged. Got %v", ids)
+	}
+	if ids := poolIDs(jp); !reflect.DeepEqual(ids, []string{"running"}) {
+		t.Fatalf("expect the running job kept. Got %v", ids)
+	}
+}
+
+func TestPurgeQueuedJobs(t *testing.T) {
+	jp, err := NewJobPoolManager(Config{MaxWorkers: 10, MinJobWorkers: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	for _, id := range []string{"running", "queued"} {
+		job := blockingJob(id, jp.sched, release)
+		jp.Pool[id] = job
+		jobCtx, jobCancel := context.WithCancel(ctx)
+		if err := job.Start(jobCtx, jobCancel); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if status, _ := jobState(jp.Pool["queued"]); status != Queued {
+		t.Fatalf("expect the second job queued. Got %d", status)
+	}
+	if ids := jp.PurgeJobs(0); len(ids) != 0 {
+		t.Fatalf("expect the running and queued jobs kept. Got %v", ids)
+	}
+}
@@ -0,0 +1,80 @@
+package control
+
+import (
+	"context"
+	"time"
+
+	"github.com/darkonie/wikiracer/worker"
+)
+
+// DefaultRetryPolicy is used when no retry policy is configured.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	Backoff:     time.Millisecond * 500,
+}
+
+// maxUnavailableWait caps the delay between the fetches of a page while the upstream is unavailable.
+const maxUnavailableWait = time.Second * 30
+
+// RetryPolicy describes how failed page fetches are repeated.
+// Only transient errors (timeouts, 5xx, connection resets) are retried. The fetches
+// rejected while the upstream is unavailable, e.g. by an open circuit breaker, are repeated
+// until it is back without using up the attempts, the delay doubles up to maxUnavailableWait.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of fetch attempts per page.
+	MaxAttempts int
+
+	// Backoff is the delay before the first retry, doubled on each next one.
+	Backoff time.Duration
+}
+
+// fetch calls w.Fetch until it succeeds, fails with permanent error or runs out of attempts.
+// onError is called for every failed attempt, but once for the fetches rejected while the
+// upstream is unavailable.
+func (r RetryPolicy) fetch(ctx context.Context, w worker.WikiCrawler, link string, onError func(error)) (*worker.Page, error) {
+	delay := r.Backoff
+	var unavailable time.Duration
+	for attempt := 1; ; attempt++ {
+		page, err := w.Fetch(ctx, link)
+		if err == nil {
+			return page, nil
+		}
+
+		// the job is over, nothing to account.
+		if ctx.Err() != nil {
+			return nil, err
+		}
+
+		wait := delay
+		switch {
+		case worker.IsUnavailable(err):
+			// the page was not fetched at all, wait for the upstream to let it through.
+			if unavailable == 0 {
+				onError(err)
+				unavailable = r.Backoff
+				if unavailable <= 0 {
+					unavailable = DefaultRetryPolicy.Backoff
+				}
+			} else {
+				unavailable *= 2
+			}
+			if unavailable > maxUnavailableWait {
+				unavailable = maxUnavailableWait
+			}
+			attempt--
+			wait = unavailable
+		case attempt >= r.MaxAttempts || !worker.IsTransient(err):
+			onError(err)
+			return nil, err
+		default:
+			onError(err)
+			delay *= 2
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
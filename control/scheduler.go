@@ -0,0 +1,144 @@
+package control
+
+import (
+	"context"
+	"sync"
+
+	"github.com/darkonie/wikiracer/primitives"
+	"github.com/darkonie/wikiracer/worker"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultMinJobWorkers is the smallest fair share of the worker budget a running job gets by default.
+const defaultMinJobWorkers = 10
+
+// newScheduler returns a scheduler which shares maxWorkers concurrent fetches between the running jobs.
+// As many jobs run as get at least minJobWorkers each, the others are queued.
+func newScheduler(maxWorkers, minJobWorkers int) *scheduler {
+	if minJobWorkers <= 0 {
+		minJobWorkers = defaultMinJobWorkers
+	}
+
+	maxJobs := maxWorkers / minJobWorkers
+	if maxJobs < 1 {
+		maxJobs = 1
+	}
+
+	return &scheduler{
+		maxJobs: maxJobs,
+		running: make(map[*Job]bool),
+		slots:   primitives.NewFairSemaphore(maxWorkers),
+	}
+}
+
+// scheduler admits the jobs to run in the order they were queued and limits the concurrent
+// fetches of all jobs, the fetch slots are taken by the running jobs in turn.
+type scheduler struct {
+	sync.Mutex
+
+	maxJobs int
+	running map[*Job]bool
+	queue   []admission
+
+	slots *primitives.FairSemaphore
+}
+
+// admission is a queued job with the function which starts it.
+type admission struct {
+	job   *Job
+	start func() error
+}
+
+// admit queues a job and starts the jobs which can run now. It returns the start error of the job
+// if it was started right away.
+func (s *scheduler) admit(j *Job, start func() error) error {
+	s.Lock()
+	s.queue = append(s.queue, admission{job: j, start: start})
+	ready := s.next()
+	s.Unlock()
+
+	return s.launch(ready, j)
+}
+
+// release frees the place of a stopped or paused job, or drops it from the queue.
+func (s *scheduler) release(j *Job) {
+	s.Lock()
+	delete(s.running, j)
+	for i, a := range s.queue {
+		if a.job == j {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			break
+		}
+	}
+	ready := s.next()
+	s.Unlock()
+
+	s.launch(ready, nil)
+}
+
+// holds returns true if the job is queued or admitted to run.
+func (s *scheduler) holds(j *Job) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.running[j] {
+		return true
+	}
+	for _, a := range s.queue {
+		if a.job == j {
+			return true
+		}
+	}
+	return false
+}
+
+// next takes the jobs which can run off the queue and updates the queue positions of the others.
+// Must be called with lock held.
+func (s *scheduler) next() []admission {
+	var ready []admission
+	for len(s.running) < s.maxJobs && len(s.queue) > 0 {
+		a := s.queue[0]
+		s.queue = s.queue[1:]
+		s.running[a.job] = true
+		ready = append(ready, a)
+	}
+
+	for _, a := range ready {
+		a.job.setQueuePosition(0)
+	}
+	for i, a := range s.queue {
+		a.job.setQueuePosition(i + 1)
+	}
+	return ready
+}
+
+// launch starts the admitted jobs, a job which fails to start gives its place up.
+func (s *scheduler) launch(ready []admission, j *Job) error {
+	var err error
+	for _, a := range ready {
+		startErr := a.start()
+		if startErr == nil {
+			continue
+		}
+
+		if a.job == j {
+			err = startErr
+		} else {
+			logrus.Errorf("unable to start queued job %s: %s", a.job.id, startErr)
+		}
+		s.release(a.job)
+	}
+	return err
+}
+
+// limit makes every fetch of a job crawler take a fetch slot, so the job does not hold one
+// while it waits to retry a fetch.
+func (s *scheduler) limit(j *Job, w worker.WikiCrawler) worker.WikiCrawler {
+	return worker.CrawlerFunc(func(ctx context.Context, link string) (*worker.Page, error) {
+		if err := s.slots.Acquire(ctx, j.id); err != nil {
+			return nil, err
+		}
+		defer s.slots.Release()
+		return w.Fetch(ctx, link)
+	})
+}
@@ -0,0 +1,130 @@
+package control
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/darkonie/wikiracer/worker"
+)
+
+// blockingJob returns a job which fetches its start page after release is closed.
+func blockingJob(id string, sched *scheduler, release chan struct{}) *Job {
+	job := NewJob("Mike Tyson", "Ukraine", "", id, time.Second*5, 10, func() worker.WikiCrawler {
+		return worker.CrawlerFunc(func(ctx context.Context, link string) (*worker.Page, error) {
+			select {
+			case <-release:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			return fakeCrawler{}.Fetch(ctx, link)
+		})
+	})
+	job.sched = sched
+	return job
+}
+
+func jobState(job *Job) (int, int) {
+	job.Lock()
+	defer job.Unlock()
+	return job.Status, job.QueuePosition
+}
+
+func TestSchedulerQueue(t *testing.T) {
+	sched := newScheduler(10, 10)
+	release := make(chan struct{})
+	first := blockingJob("first", sched, release)
+	second := blockingJob("second", sched, release)
+	third := blockingJob("third", sched, release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	for _, job := range []*Job{first, second, third} {
+		jobCtx, jobCancel := context.WithCancel(ctx)
+		if err := job.Start(jobCtx, jobCancel); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if status, position := jobState(first); status != Running || position != 0 {
+		t.Fatalf("expect the first job running. Got %d, %d", status, position)
+	}
+	if status, position := jobState(third); status != Queued || position != 2 {
+		t.Fatalf("expect the third job queued second. Got %d, %d", status, position)
+	}
+
+	// a cancelled job leaves the queue.
+	if err := second.Stop(Cancelled); err != nil {
+		t.Fatal(err)
+	}
+	if status, position := jobState(third); status != Queued || position != 1 {
+		t.Fatalf("expect the third job queued first. Got %d, %d", status, position)
+	}
+
+	// a paused job gives its place up and queues again when unpaused.
+	if err := first.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := jobState(third); status != Running {
+		t.Fatalf("expect the third job running. Got %d", status)
+	}
+	if err := first.Unpause(); err != nil {
+		t.Fatal(err)
+	}
+	if status, position := jobState(first); status != Queued || position != 1 {
+		t.Fatalf("expect the first job queued. Got %d, %d", status, position)
+	}
+
+	// the first job runs when the third one finds the page.
+	close(release)
+	for _, job := range []*Job{third, first} {
+		for i := 0; i < 100; i++ {
+			if status, _ := jobState(job); status == PageFound {
+				break
+			}
+			time.Sleep(time.Millisecond * 20)
+		}
+		if status, _ := jobState(job); status != PageFound {
+			t.Fatalf("expect job %s to find the page. Got %d", job.id, status)
+		}
+	}
+}
+
+func TestSchedulerUnavailable(t *testing.T) {
+	// both jobs run, sharing a single fetch slot.
+	sched := newScheduler(1, 1)
+	sched.maxJobs = 2
+
+	// the dead job waits for its upstream without holding the fetch slots.
+	dead := NewJob("Mike Tyson", "Ukraine", "", "dead", time.Second*5, 10, func() worker.WikiCrawler {
+		return worker.CrawlerFunc(func(ctx context.Context, link string) (*worker.Page, error) {
+			return nil, worker.ErrCircuitOpen
+		})
+	})
+	dead.sched = sched
+	dead.retry = RetryPolicy{MaxAttempts: 1, Backoff: time.Millisecond * 200}
+
+	alive := NewJob("Mike Tyson", "Ukraine", "", "alive", time.Second*5, 10, func() worker.WikiCrawler {
+		return fakeCrawler{}
+	})
+	alive.sched = sched
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	deadCtx, deadCancel := context.WithCancel(ctx)
+	defer deadCancel()
+	if err := dead.Start(deadCtx, deadCancel); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 50)
+
+	aliveCtx, aliveCancel := context.WithCancel(ctx)
+	if err := alive.Start(aliveCtx, aliveCancel); err != nil {
+		t.Fatal(err)
+	}
+	<-aliveCtx.Done()
+
+	if status, _ := jobState(alive); status != PageFound {
+		t.Fatalf("expect the other job to find the page. Got %d", status)
+	}
+}
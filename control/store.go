@@ -0,0 +1,180 @@
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// JobStore persists the jobs, so their definitions, status history, paths and stats survive restarts.
+type JobStore interface {
+	// Save writes a job replacing its previous version.
+	Save(job *Job) error
+
+	// Load returns the saved jobs by id.
+	Load() (map[string]*Job, error)
+
+	// SaveSnapshot writes the search state of a job replacing its previous checkpoint.
+	SaveSnapshot(id string, s *Snapshot) error
+
+	// LoadSnapshot returns the last checkpoint of a job, nil if there is none.
+	LoadSnapshot(id string) (*Snapshot, error)
+
+	// Delete removes a job and its checkpoint.
+	Delete(id string) error
+}
+
+// NewFileStore returns a job store which keeps every job in a json file in dir.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create job store dir: %s", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// FileStore is a JobStore backed by a directory of {id}.json files and {id}.snapshot checkpoints.
+type FileStore struct {
+	// serializes the saves, so a job is encoded and written by one save at a time
+	// and the last save wins.
+	sync.Mutex
+
+	dir string
+}
+
+func (s *FileStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *FileStore) snapshotPath(id string) string {
+	return filepath.Join(s.dir, id+".snapshot")
+}
+
+// Save implements JobStore interface. The file is replaced atomically.
+func (s *FileStore) Save(job *Job) error {
+	return s.write(job.id, s.path(job.id), job)
+}
+
+// SaveSnapshot implements JobStore interface. The file is replaced atomically.
+func (s *FileStore) SaveSnapshot(id string, snapshot *Snapshot) error {
+	return s.write(id, s.snapshotPath(id), snapshot)
+}
+
+// LoadSnapshot implements JobStore interface.
+func (s *FileStore) LoadSnapshot(id string) (*Snapshot, error) {
+	data, err := ioutil.ReadFile(s.snapshotPath(id))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &Snapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return nil, fmt.Errorf("unable to decode job %s checkpoint: %s", id, err)
+	}
+	return snapshot, nil
+}
+
+// Delete implements JobStore interface. Missing files are ignored.
+func (s *FileStore) Delete(id string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, path := range []string{s.path(id), s.snapshotPath(id)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// write encodes v to a temp file and renames it to path.
+func (s *FileStore) write(id, path string, v interface{}) error {
+	s.Lock()
+	defer s.Unlock()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(s.dir, id+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load implements JobStore interface. The files which cannot be read are skipped.
+func (s *FileStore) Load() (map[string]*Job, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make(map[string]*Job)
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(s.dir, f.Name()))
+		if err != nil {
+			logrus.Errorf("unable to read job %s: %s", f.Name(), err)
+			continue
+		}
+
+		job := &Job{}
+		if err := json.Unmarshal(data, job); err != nil {
+			logrus.Errorf("unable to decode job %s: %s", f.Name(), err)
+			continue
+		}
+		jobs[strings.TrimSuffix(f.Name(), ".json")] = job
+	}
+	return jobs, nil
+}
+
+// restoreJob prepares a job loaded from store. A job which was running when the server
+// stopped is interrupted, it can be resumed from its last checkpoint.
+func restoreJob(id string, j *Job, store JobStore) {
+	j.id = id
+	j.store = store
+	j.cancel = func() {}
+	j.retry = DefaultRetryPolicy
+	j.checkpointInterval = defaultCheckpointInterval
+	if timeout, err := time.ParseDuration(j.Timeout); err == nil {
+		j.timeout = timeout
+	}
+	if j.ErrorCounts == nil {
+		j.ErrorCounts = make(map[string]uint64)
+	}
+
+	if j.Status != Running && j.Status != Paused && j.Status != Queued && !j.IsRunning {
+		j.estimateSize()
+		return
+	}
+
+	j.IsRunning = false
+	j.QueuePosition = 0
+	j.EndTime = j.UpdateTime
+	j.setStatus(Interrupted)
+	j.save()
+	j.estimateSize()
+}
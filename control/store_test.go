@@ -0,0 +1,147 @@
+package control
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/darkonie/wikiracer/fakewiki"
+)
+
+func TestFileStoreRestore(t *testing.T) {
+	srv := fakewiki.NewServer(fakewiki.MapGraph{
+		"Mike Tyson": {"Boxing"},
+		"Boxing":     {"Ukraine"},
+		"Ukraine":    nil,
+	}, 0)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jp, err := NewJobPoolManager(Config{Transport: srv.Client().Transport, Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := jp.AddJob(context.Background(), "Mike Tyson", "Ukraine", "report", time.Minute, 1, JobOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	if err := jp.StartJob(ctx, cancel, id); err != nil {
+		t.Fatal(err)
+	}
+	<-ctx.Done()
+
+	// a job running when the server stopped.
+	running := NewJob("Mike Tyson", "Boxing", "", "running", time.Minute, 1, nil)
+	running.store = store
+	running.IsRunning = true
+	running.setStatus(Running)
+	running.StartTime = time.Now()
+	running.save()
+
+	jp, err = NewJobPoolManager(Config{Transport: srv.Client().Transport, Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, ok := jp.GetJob(id)
+	if !ok {
+		t.Fatal("expect the job restored")
+	}
+	if job.Status != PageFound || job.Comment != "report" || job.CrawlMethod != DefaultCrawlMethod || len(job.Path) != 3 || job.PagesVisited == 0 {
+		t.Fatalf("unexpected restored job %+v", job)
+	}
+
+	var history []int
+	for _, c := range job.History {
+		history = append(history, c.Status)
+	}
+	if !reflect.DeepEqual(history, []int{Unchanged, Running, PageFound}) {
+		t.Fatalf("unexpected status history %v", history)
+	}
+
+	job, _ = jp.GetJob("running")
+	if job.Status != Interrupted || job.IsRunning || job.EndTime.IsZero() {
+		t.Fatalf("expect interrupted job. Got %+v", job)
+	}
+	if err := job.Start(context.Background(), func() {}); err == nil {
+		t.Fatal("expect restored job not to start")
+	}
+
+	// the interrupted status is saved too.
+	jobs, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobs["running"].Status != Interrupted {
+		t.Fatalf("expect interrupted job saved. Got %d", jobs["running"].Status)
+	}
+}
+
+func TestFileStoreResume(t *testing.T) {
+	srv := fakewiki.NewServer(fakewiki.MapGraph{
+		"Mike Tyson": {"Boxing"},
+		"Boxing":     {"Ukraine"},
+		"Ukraine":    nil,
+	}, 0)
+	defer srv.Close()
+
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jp, err := NewJobPoolManager(Config{Transport: srv.Client().Transport, Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := jp.AddJob(context.Background(), "Mike Tyson", "Ukraine", "", time.Minute, 1, JobOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jp.ResumeJob(context.Background(), func() {}, id, 0); err != ErrNoCheckpoint {
+		t.Fatalf("expect no checkpoint. Got %v", err)
+	}
+
+	// the start page is fetched, Boxing is left in the frontier.
+	snapshot := &Snapshot{
+		Time: time.Now(),
+		Pages: []SnapshotPage{
+			{Name: "Mike Tyson", Depth: 1, Prev: -1},
+			{Name: "Boxing", Depth: 2, Prev: 0},
+		},
+		Frontier: []SnapshotItem{{Page: 1, Priority: 2}},
+		Visited:  []string{"Mike Tyson"},
+	}
+	if err := store.SaveSnapshot(id, snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	jp, err = NewJobPoolManager(Config{Transport: srv.Client().Transport, Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := jp.ResumeJob(ctx, cancel, id, 0); err != nil {
+		t.Fatal(err)
+	}
+	<-ctx.Done()
+
+	job, _ := jp.GetJob(id)
+	job.Lock()
+	defer job.Unlock()
+	if result := strings.Join(titles(job.Path), "_"); result != "Mike Tyson_Boxing_Ukraine" || job.Status != PageFound {
+		t.Fatalf("expect resumed job to find the page. Got %s, status %d", result, job.Status)
+	}
+}
@@ -0,0 +1,69 @@
+package control
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/darkonie/wikiracer/worker"
+	"github.com/sirupsen/logrus"
+)
+
+// resolveTimeout limits the title resolution before a job is added.
+const resolveTimeout = time.Second * 10
+
+// reasons a title cannot be raced to.
+const (
+	TitleMissing   = "missing"
+	TitleAmbiguous = "ambiguous"
+)
+
+// TitleError is returned when a start or destination page does not exist, or it is a disambiguation
+// page a job skipping them would never leave or reach.
+type TitleError struct {
+	// Field is start_page or destination_page.
+	Field  string
+	Title  string
+	Reason string
+
+	// Suggestions are the titles the user may have meant.
+	Suggestions []string
+}
+
+func (e *TitleError) Error() string {
+	msg := fmt.Sprintf("%s %q does not exist", e.Field, e.Title)
+	if e.Reason == TitleAmbiguous {
+		msg = fmt.Sprintf("%s %q is a disambiguation page, which is skipped", e.Field, e.Title)
+	}
+	if len(e.Suggestions) == 0 {
+		return msg
+	}
+	return fmt.Sprintf("%s, did you mean %q?", msg, strings.Join(e.Suggestions, `", "`))
+}
+
+// resolveTitle checks a title with the crawler. Nil resolution means it was not checked: the crawler
+// does not support it, the job reads old revisions or the wiki could not be reached.
+func resolveTitle(ctx context.Context, f crawlerFactory, env worker.Env, opts JobOptions, field, title string) (*worker.TitleResolution, error) {
+	// the page could be missing now, but exist at that time.
+	if f.Resolve == nil || opts.AsOf != nil {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, resolveTimeout)
+	defer cancel()
+
+	res, err := f.Resolve(ctx, env, f.opts, title)
+	if err != nil {
+		logrus.Warnf("unable to resolve %s %q, using it as is: %s", field, title, err)
+		return nil, nil
+	}
+
+	switch {
+	case res.Missing:
+		return nil, &TitleError{Field: field, Title: title, Reason: TitleMissing, Suggestions: res.Suggestions}
+	case res.Disambiguation && opts.Disambiguation == DisambiguationSkip:
+		return nil, &TitleError{Field: field, Title: res.Title, Reason: TitleAmbiguous}
+	}
+	return res, nil
+}
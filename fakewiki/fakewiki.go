@@ -0,0 +1,766 @@
+// Package fakewiki implements a fake MediaWiki server backed by an in-memory link graph.
+// It speaks the subset of the MediaWiki API (action=query&prop=links with plcontinue pagination,
+// prop=revisions, prop=categories, prop=pageprops with redirects, list=categorymembers, list=search and action=parse) and renders /wiki/Title, /w/index.php?oldid= and Parsoid
+// /api/rest_v1/page/html/Title HTML pages used by the crawlers, so the races can run without network.
+package fakewiki
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPageSize is the default number of links returned in one API response.
+const DefaultPageSize = 500
+
+// Created is the time of the only revision every fake page has.
+var Created = time.Date(2001, time.January, 15, 0, 0, 0, 0, time.UTC)
+
+// Graph is a wiki link graph served by the fake server.
+// Pages with titles ending with "(disambiguation)" are served as disambiguation pages.
+// Every page has a single revision made at Created time.
+type Graph interface {
+	// Links returns the links of a page and false if the page does not exist.
+	Links(title string) ([]string, bool)
+}
+
+// MapGraph is a Graph backed by a map of page titles to links.
+type MapGraph map[string][]string
+
+// Links implements Graph interface.
+func (g MapGraph) Links(title string) ([]string, bool) {
+	links, ok := g[title]
+	return links, ok
+}
+
+// Titles implements Listed interface.
+func (g MapGraph) Titles() []string {
+	titles := make([]string, 0, len(g))
+	for t := range g {
+		titles = append(titles, t)
+	}
+	return titles
+}
+
+// Listed is a Graph which can list its pages, list=search finds the pages only in Listed graphs.
+type Listed interface {
+	Graph
+
+	// Titles returns the titles of all pages.
+	Titles() []string
+}
+
+// Redirecting is a Graph with redirect pages.
+type Redirecting interface {
+	Graph
+
+	// Redirect returns the target of a redirect page and false if the page is not a redirect.
+	Redirect(title string) (string, bool)
+}
+
+// RedirectGraph adds redirect pages to a Graph.
+type RedirectGraph struct {
+	Graph
+
+	// Redirects maps redirect titles to their targets.
+	Redirects map[string]string
+}
+
+// Redirect implements Redirecting interface.
+func (g RedirectGraph) Redirect(title string) (string, bool) {
+	target, ok := g.Redirects[title]
+	return target, ok
+}
+
+// Titles implements Listed interface if the Graph does, the redirects are not listed.
+func (g RedirectGraph) Titles() []string {
+	if l, ok := g.Graph.(Listed); ok {
+		return l.Titles()
+	}
+	return nil
+}
+
+// Categorized is a Graph which knows the page categories. Category titles are prefixed with "Category:",
+// the categories of a category page are its parent categories.
+type Categorized interface {
+	Graph
+
+	// Categories returns the categories of a page.
+	Categories(title string) []string
+}
+
+// CategoryGraph adds categories to a Graph.
+type CategoryGraph struct {
+	Graph
+
+	// Parents maps page and category titles to their categories.
+	Parents map[string][]string
+
+	// Hidden are the maintenance categories, which prop=categories leaves out with clshow=!hidden.
+	Hidden map[string]bool
+}
+
+// Categories implements Categorized interface.
+func (g CategoryGraph) Categories(title string) []string {
+	return g.Parents[title]
+}
+
+// NewHandler returns an http handler which serves /w/api.php and /wiki/ pages of graph g.
+// pageSize limits the number of links in one API response, the rest is returned with plcontinue.
+func NewHandler(g Graph, pageSize int) http.Handler {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+
+	h := &handler{
+		graph:     g,
+		pageSize:  pageSize,
+		revisions: make(map[string]string),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/w/api.php", h.api)
+	mux.HandleFunc("/w/index.php", h.index)
+	mux.HandleFunc("/wiki/", h.html)
+	mux.HandleFunc("/api/rest_v1/page/html/", h.parsoid)
+	return mux
+}
+
+// NewServer starts a fake wiki server for graph g.
+func NewServer(g Graph, pageSize int) *Server {
+	return &Server{
+		Server: httptest.NewServer(NewHandler(g, pageSize)),
+	}
+}
+
+// Server is a running fake wiki server.
+type Server struct {
+	*httptest.Server
+}
+
+// Client returns an http client which sends the requests for any host to the fake server,
+// so the crawlers can be used without changing their endpoints.
+func (s *Server) Client() *http.Client {
+	target, _ := url.Parse(s.URL)
+	return &http.Client{
+		Transport: &rewriteTransport{target: target},
+	}
+}
+
+type rewriteTransport struct {
+	target *url.URL
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (t *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := new(http.Request)
+	*r = *req
+
+	u := *req.URL
+	u.Scheme = t.target.Scheme
+	u.Host = t.target.Host
+	r.URL = &u
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+type handler struct {
+	sync.Mutex
+
+	graph    Graph
+	pageSize int
+
+	// revisions maps revision ids to page titles.
+	revisions map[string]string
+}
+
+// normalize converts the title to the form used in the graph.
+func normalize(title string) string {
+	return strings.Replace(title, "_", " ", -1)
+}
+
+func pageID(title string) uint32 {
+	return crc32.ChecksumIEEE([]byte(title))
+}
+
+func (h *handler) links(title string) ([]string, bool) {
+	links, ok := h.graph.Links(title)
+	if !ok {
+		return nil, false
+	}
+
+	sorted := make([]string, len(links))
+	copy(sorted, links)
+	sort.Strings(sorted)
+	return sorted, true
+}
+
+type link struct {
+	Ns    int    `json:"ns"`
+	Title string `json:"title"`
+}
+
+type page struct {
+	PageID    uint32            `json:"pageid,omitempty"`
+	Ns        int               `json:"ns"`
+	Title     string            `json:"title"`
+	Missing   *string           `json:"missing,omitempty"`
+	Links     []link            `json:"links,omitempty"`
+	PageProps map[string]string `json:"pageprops,omitempty"`
+}
+
+func isDisambiguation(title string) bool {
+	return strings.HasSuffix(title, "(disambiguation)")
+}
+
+// props returns the set of requested prop values.
+func props(q url.Values) map[string]bool {
+	set := map[string]bool{}
+	for _, p := range strings.Split(q.Get("prop"), "|") {
+		set[p] = true
+	}
+	return set
+}
+
+type revision struct {
+	RevID     uint32 `json:"revid"`
+	ParentID  uint32 `json:"parentid"`
+	Timestamp string `json:"timestamp"`
+}
+
+func (h *handler) api(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	prop := props(q)
+	switch {
+	case q.Get("action") == "query" && q.Get("list") == "categorymembers":
+		h.categoryMembers(w, q)
+	case q.Get("action") == "query" && prop["links"]:
+		h.queryLinks(w, q, prop)
+	case q.Get("action") == "query" && prop["revisions"]:
+		h.queryRevisions(w, q)
+	case q.Get("action") == "query" && prop["categories"]:
+		h.queryCategories(w, q)
+	case q.Get("action") == "query" && prop["pageprops"]:
+		h.queryPageProps(w, q)
+	case q.Get("action") == "query" && q.Get("list") == "search":
+		h.search(w, q)
+	case q.Get("action") == "parse":
+		h.parse(w, q)
+	default:
+		apiError(w, "badvalue", "only action=query&prop=links|revisions|categories|pageprops, list=categorymembers|search and action=parse are supported")
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// queryRevisions serves prop=revisions with rvdir=older and rvstart, the only revision is returned
+// if it was made before rvstart.
+func (h *handler) queryRevisions(w http.ResponseWriter, q url.Values) {
+	start := time.Now()
+	if rvstart := q.Get("rvstart"); rvstart != "" {
+		t, err := time.Parse(time.RFC3339, rvstart)
+		if err != nil {
+			apiError(w, "badtimestamp", "invalid rvstart")
+			return
+		}
+		start = t
+	}
+
+	pages := map[string]interface{}{}
+	for i, t := range strings.Split(q.Get("titles"), "|") {
+		title := normalize(t)
+		if _, ok := h.graph.Links(title); !ok {
+			pages[strconv.Itoa(-1-i)] = &page{Title: title, Missing: new(string)}
+			continue
+		}
+
+		id := pageID(title)
+		p := map[string]interface{}{"pageid": id, "ns": 0, "title": title}
+		if !start.Before(Created) {
+			h.Lock()
+			h.revisions[strconv.FormatUint(uint64(id), 10)] = title
+			h.Unlock()
+			p["revisions"] = []revision{{RevID: id, Timestamp: Created.Format(time.RFC3339)}}
+		}
+		pages[strconv.FormatUint(uint64(id), 10)] = p
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"batchcomplete": "",
+		"query":         map[string]interface{}{"pages": pages},
+	})
+}
+
+// revisionTitle returns the title of a page revision resolved before.
+func (h *handler) revisionTitle(oldid string) (string, bool) {
+	h.Lock()
+	defer h.Unlock()
+	title, ok := h.revisions[oldid]
+	return title, ok
+}
+
+// parse serves action=parse&oldid with prop=links|properties.
+func (h *handler) parse(w http.ResponseWriter, q url.Values) {
+	title, ok := h.revisionTitle(q.Get("oldid"))
+	if !ok {
+		apiError(w, "nosuchrevid", "There is no revision with ID "+q.Get("oldid"))
+		return
+	}
+
+	links, _ := h.links(title)
+	parsed := map[string]interface{}{
+		"title":  title,
+		"pageid": pageID(title),
+		"revid":  pageID(title),
+	}
+
+	prop := props(q)
+	if prop["links"] {
+		l := []map[string]interface{}{}
+		for _, t := range links {
+			l = append(l, map[string]interface{}{"ns": namespace(t), "exists": "", "*": t})
+		}
+		parsed["links"] = l
+	}
+
+	if prop["properties"] && isDisambiguation(title) {
+		parsed["properties"] = []map[string]string{{"name": "disambiguation", "*": ""}}
+	}
+
+	writeJSON(w, map[string]interface{}{"parse": parsed})
+}
+
+// queryLinks serves prop=links with plcontinue pagination.
+func (h *handler) queryLinks(w http.ResponseWriter, q url.Values, prop map[string]bool) {
+	limit := h.pageSize
+	if l, err := strconv.Atoi(q.Get("pllimit")); err == nil && l > 0 && l < limit {
+		limit = l
+	}
+
+	resp := map[string]interface{}{}
+	pages := map[string]*page{}
+	for i, t := range strings.Split(q.Get("titles"), "|") {
+		title := normalize(t)
+		links, ok := h.links(title)
+		if !ok {
+			pages[strconv.Itoa(-1-i)] = &page{Title: title, Missing: new(string)}
+			continue
+		}
+
+		id := pageID(title)
+		offset := 0
+		if cont := q.Get("plcontinue"); cont != "" {
+			parts := strings.Split(cont, "|")
+			if len(parts) != 3 || parts[0] != strconv.FormatUint(uint64(id), 10) {
+				apiError(w, "badcontinue", "invalid plcontinue")
+				return
+			}
+			offset, _ = strconv.Atoi(parts[2])
+		}
+
+		end := offset + limit
+		if end >= len(links) {
+			end = len(links)
+		} else {
+			resp["continue"] = map[string]string{
+				"plcontinue": fmt.Sprintf("%d|0|%d", id, end),
+				"continue":   "||",
+			}
+		}
+
+		p := &page{PageID: id, Title: title}
+		if prop["pageprops"] && offset == 0 && isDisambiguation(title) {
+			p.PageProps = map[string]string{"disambiguation": ""}
+		}
+
+		for _, l := range links[offset:end] {
+			p.Links = append(p.Links, link{Ns: namespace(l), Title: l})
+		}
+		pages[strconv.FormatUint(uint64(id), 10)] = p
+	}
+
+	resp["batchcomplete"] = ""
+	resp["query"] = map[string]interface{}{"pages": pages}
+	writeJSON(w, resp)
+}
+
+// categories returns the sorted categories of a page, none if the graph is not Categorized.
+func (h *handler) categories(title string) []string {
+	g, ok := h.graph.(Categorized)
+	if !ok {
+		return nil
+	}
+
+	categories := append([]string(nil), g.Categories(title)...)
+	sort.Strings(categories)
+	return categories
+}
+
+// hidden returns true if the category is a hidden one of CategoryGraph.
+func (h *handler) hidden(category string) bool {
+	g, ok := h.graph.(CategoryGraph)
+	return ok && g.Hidden[category]
+}
+
+// exists returns true if the page is in the graph or it is a category known from the page categories.
+func (h *handler) exists(title string) bool {
+	if _, ok := h.graph.Links(title); ok {
+		return true
+	}
+
+	g, ok := h.graph.(CategoryGraph)
+	if !ok || !strings.HasPrefix(title, categoryPrefix) {
+		return false
+	}
+	if _, ok := g.Parents[title]; ok {
+		return true
+	}
+	for _, parents := range g.Parents {
+		for _, p := range parents {
+			if p == title {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+const categoryPrefix = "Category:"
+
+// namespaces are the namespace numbers of the title prefixes known to the fake wiki.
+var namespaces = map[string]int{
+	"Special":  -1,
+	"Talk":     1,
+	"User":     2,
+	"File":     6,
+	"Template": 10,
+	"Category": 14,
+}
+
+// namespace returns the namespace number of a title.
+func namespace(title string) int {
+	if index := strings.Index(title, ":"); index > 0 {
+		return namespaces[title[:index]]
+	}
+	return 0
+}
+
+// queryCategories serves prop=categories. All categories are returned at once, the titles
+// with underscores are reported in normalized list. clshow=!hidden drops the hidden categories.
+func (h *handler) queryCategories(w http.ResponseWriter, q url.Values) {
+	pages := map[string]interface{}{}
+	normalized := []map[string]string{}
+	for i, t := range strings.Split(q.Get("titles"), "|") {
+		title := normalize(t)
+		if title != t {
+			normalized = append(normalized, map[string]string{"from": t, "to": title})
+		}
+
+		if !h.exists(title) {
+			pages[strconv.Itoa(-1-i)] = &page{Ns: namespace(title), Title: title, Missing: new(string)}
+			continue
+		}
+
+		p := map[string]interface{}{"pageid": pageID(title), "ns": namespace(title), "title": title}
+		categories := []link{}
+		for _, c := range h.categories(title) {
+			if q.Get("clshow") == "!hidden" && h.hidden(c) {
+				continue
+			}
+			categories = append(categories, link{Ns: 14, Title: c})
+		}
+		if len(categories) > 0 {
+			p["categories"] = categories
+		}
+		pages[strconv.FormatUint(uint64(pageID(title)), 10)] = p
+	}
+
+	query := map[string]interface{}{"pages": pages}
+	if len(normalized) > 0 {
+		query["normalized"] = normalized
+	}
+	writeJSON(w, map[string]interface{}{"batchcomplete": "", "query": query})
+}
+
+// categoryMembers serves list=categorymembers with cmtype=subcat|page and cmcontinue pagination.
+func (h *handler) categoryMembers(w http.ResponseWriter, q url.Values) {
+	g, _ := h.graph.(CategoryGraph)
+	category := normalize(q.Get("cmtitle"))
+
+	types := map[string]bool{}
+	for _, t := range strings.Split(q.Get("cmtype"), "|") {
+		types[t] = true
+	}
+	if q.Get("cmtype") == "" {
+		types["page"], types["subcat"] = true, true
+	}
+
+	members := []string{}
+	for title, parents := range g.Parents {
+		kind := "page"
+		if namespace(title) == 14 {
+			kind = "subcat"
+		}
+		if !types[kind] {
+			continue
+		}
+		for _, p := range parents {
+			if p == category {
+				members = append(members, title)
+				break
+			}
+		}
+	}
+	sort.Strings(members)
+
+	limit := h.pageSize
+	if l, err := strconv.Atoi(q.Get("cmlimit")); err == nil && l > 0 && l < limit {
+		limit = l
+	}
+
+	offset := 0
+	if cont := q.Get("cmcontinue"); cont != "" {
+		var err error
+		if offset, err = strconv.Atoi(cont); err != nil {
+			apiError(w, "badcontinue", "invalid cmcontinue")
+			return
+		}
+	}
+	if offset > len(members) {
+		offset = len(members)
+	}
+
+	resp := map[string]interface{}{}
+	end := offset + limit
+	if end >= len(members) {
+		end = len(members)
+	} else {
+		resp["continue"] = map[string]string{"cmcontinue": strconv.Itoa(end), "continue": "-||"}
+	}
+
+	list := []link{}
+	for _, m := range members[offset:end] {
+		list = append(list, link{Ns: namespace(m), Title: m})
+	}
+	resp["batchcomplete"] = ""
+	resp["query"] = map[string]interface{}{"categorymembers": list}
+	writeJSON(w, resp)
+}
+
+// queryPageProps serves prop=pageprops, the redirects are resolved if redirects parameter is set.
+func (h *handler) queryPageProps(w http.ResponseWriter, q url.Values) {
+	pages := map[string]*page{}
+	normalized := []map[string]string{}
+	redirects := []map[string]string{}
+	for i, t := range strings.Split(q.Get("titles"), "|") {
+		title := normalize(t)
+		if title != t {
+			normalized = append(normalized, map[string]string{"from": t, "to": title})
+		}
+
+		if g, ok := h.graph.(Redirecting); ok && q.Get("redirects") != "" {
+			if target, ok := g.Redirect(title); ok {
+				redirects = append(redirects, map[string]string{"from": title, "to": target})
+				title = target
+			}
+		}
+
+		if !h.exists(title) {
+			pages[strconv.Itoa(-1-i)] = &page{Ns: namespace(title), Title: title, Missing: new(string)}
+			continue
+		}
+
+		p := &page{PageID: pageID(title), Ns: namespace(title), Title: title}
+		if isDisambiguation(title) {
+			p.PageProps = map[string]string{"disambiguation": ""}
+		}
+		pages[strconv.FormatUint(uint64(pageID(title)), 10)] = p
+	}
+
+	query := map[string]interface{}{"pages": pages}
+	if len(normalized) > 0 {
+		query["normalized"] = normalized
+	}
+	if len(redirects) > 0 {
+		query["redirects"] = redirects
+	}
+	writeJSON(w, map[string]interface{}{"batchcomplete": "", "query": query})
+}
+
+// search serves list=search. The pages of srnamespace with srsearch in the title, ignoring case, are found.
+// The spelling suggestion is the lower case title closest to srsearch, if it is at most two edits away.
+func (h *handler) search(w http.ResponseWriter, q url.Values) {
+	var titles []string
+	if g, ok := h.graph.(Listed); ok {
+		titles = g.Titles()
+	}
+	sort.Strings(titles)
+
+	limit := 10
+	if l, err := strconv.Atoi(q.Get("srlimit")); err == nil && l > 0 {
+		limit = l
+	}
+	ns, _ := strconv.Atoi(q.Get("srnamespace"))
+	query := strings.ToLower(q.Get("srsearch"))
+
+	found := []link{}
+	suggestion, best := "", 3
+	for _, t := range titles {
+		if namespace(t) != ns {
+			continue
+		}
+
+		lower := strings.ToLower(t)
+		if strings.Contains(lower, query) && len(found) < limit {
+			found = append(found, link{Ns: ns, Title: t})
+		}
+		if d := distance(lower, query); d > 0 && d < best {
+			suggestion, best = lower, d
+		}
+	}
+
+	result := map[string]interface{}{"search": found, "searchinfo": map[string]interface{}{"totalhits": len(found)}}
+	if suggestion != "" {
+		result["searchinfo"] = map[string]interface{}{"totalhits": len(found), "suggestion": suggestion}
+	}
+	writeJSON(w, map[string]interface{}{"batchcomplete": "", "query": result})
+}
+
+// distance is the Levenshtein distance of the strings.
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func apiError(w http.ResponseWriter, code, info string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("MediaWiki-API-Error", code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{"code": code, "info": info},
+	})
+}
+
+// href returns the link to a page as rendered by MediaWiki.
+func href(title string) string {
+	return "/wiki/" + url.PathEscape(strings.Replace(title, " ", "_", -1))
+}
+
+func (h *handler) html(w http.ResponseWriter, r *http.Request) {
+	h.render(w, r, normalize(strings.TrimPrefix(r.URL.Path, "/wiki/")))
+}
+
+// index serves /w/index.php?oldid= page revisions.
+func (h *handler) index(w http.ResponseWriter, r *http.Request) {
+	title, ok := h.revisionTitle(r.URL.Query().Get("oldid"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	h.render(w, r, title)
+}
+
+// render writes the html of a page as it is rendered by MediaWiki.
+func (h *handler) render(w http.ResponseWriter, r *http.Request, title string) {
+	links, ok := h.links(title)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html><head><title>%s - Wikipedia</title></head><body>\n", html.EscapeString(title))
+	fmt.Fprintf(w, "<a href=\"/wiki/Special:Random\">Random article</a>\n")
+	fmt.Fprintf(w, "<h1 id=\"firstHeading\">%s</h1>\n<div id=\"mw-content-text\">\n", html.EscapeString(title))
+	if isDisambiguation(title) {
+		fmt.Fprintf(w, "<table id=\"disambigbox\" class=\"metadata plainlinks dmbox dmbox-disambig\"><tr><td>This disambiguation page lists articles associated with the title %s.</td></tr></table>\n", html.EscapeString(title))
+	}
+	// the first link is in the lead section, the rest are in "Related pages" section.
+	for i, l := range links {
+		a := fmt.Sprintf("<a href=\"%s\" title=\"%s\">%s</a>", html.EscapeString(href(l)), html.EscapeString(l), html.EscapeString(l))
+		if i == 0 {
+			fmt.Fprintf(w, "<p><b>%s</b> is a page. It is related to %s. It is fake.</p>\n", html.EscapeString(title), a)
+			fmt.Fprintf(w, "<h2><span class=\"mw-headline\" id=\"Related_pages\">Related pages</span>"+
+				"<span class=\"mw-editsection\">[<a href=\"/w/index.php?title=%s&amp;action=edit&amp;section=1\">edit</a>]</span></h2>\n",
+				url.QueryEscape(title))
+			continue
+		}
+		fmt.Fprintf(w, "<p>See %s for more.</p>\n", a)
+	}
+	fmt.Fprintf(w, "<a href=\"#top\">Back to top</a>\n</div></body></html>\n")
+}
+
+// parsoid serves /api/rest_v1/page/html/{title} and /api/rest_v1/page/html/{title}/{revid}
+// in Parsoid HTML format.
+func (h *handler) parsoid(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/api/rest_v1/page/html/"), "/", 2)
+	title := normalize(parts[0])
+	if len(parts) == 2 {
+		if t, ok := h.revisionTitle(parts[1]); !ok || t != title {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	links, ok := h.links(title)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	a := func(l string) string {
+		return fmt.Sprintf("<a rel=\"mw:WikiLink\" href=\"./%s\" title=\"%s\">%s</a>",
+			html.EscapeString(url.PathEscape(strings.Replace(l, " ", "_", -1))), html.EscapeString(l), html.EscapeString(l))
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8; profile=\"https://www.mediawiki.org/wiki/Specs/HTML/2.1.0\"")
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html prefix=\"dc: http://purl.org/dc/terms/ mw: http://mediawiki.org/rdf/\"><head>")
+	if isDisambiguation(title) {
+		fmt.Fprintf(w, "<meta property=\"mw:PageProp/disambiguation\"/>")
+	}
+	fmt.Fprintf(w, "<title>%s</title></head><body>\n", html.EscapeString(title))
+
+	// the first link is in the lead section, the rest are in "Related pages" section.
+	fmt.Fprintf(w, "<section data-mw-section-id=\"0\">")
+	if len(links) > 0 {
+		fmt.Fprintf(w, "<p><b>%s</b> is a page. It is related to %s. It is fake.</p>", html.EscapeString(title), a(links[0]))
+	}
+	fmt.Fprintf(w, "<p>Missing <a rel=\"mw:WikiLink\" href=\"./Missing_page?action=edit&amp;redlink=1\" title=\"Missing page\" class=\"new\">page</a>.</p>")
+	fmt.Fprintf(w, "</section>\n")
+
+	if len(links) > 1 {
+		fmt.Fprintf(w, "<section data-mw-section-id=\"1\"><h2 id=\"Related_pages\">Related pages</h2>")
+		for _, l := range links[1:] {
+			fmt.Fprintf(w, "<p>See %s for more.</p>", a(l))
+		}
+		fmt.Fprintf(w, "<p><a rel=\"mw:WikiLink/Interwiki\" href=\"https://de.wikipedia.org/wiki/%s\">de</a></p>", url.PathEscape(title))
+		fmt.Fprintf(w, "</section>\n")
+	}
+	fmt.Fprintf(w, "</body></html>\n")
+}
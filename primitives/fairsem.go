@@ -0,0 +1,117 @@
+package primitives
+
+import (
+	"context"
+	"sync"
+)
+
+// NewFairSemaphore returns a semaphore with size slots.
+func NewFairSemaphore(size int) *FairSemaphore {
+	return &FairSemaphore{
+		size:    size,
+		waiters: make(map[string][]chan struct{}),
+	}
+}
+
+// FairSemaphore limits the number of concurrent holders. When all slots are taken, the freed slots
+// are handed to the waiting keys in turn, so a key with many waiters does not starve the others.
+type FairSemaphore struct {
+	sync.Mutex
+
+	size, used int
+
+	// waiters are the channels of the waiting callers by key, order is the turn of the keys.
+	waiters map[string][]chan struct{}
+	order   []string
+}
+
+// Size returns the number of slots.
+func (s *FairSemaphore) Size() int {
+	return s.size
+}
+
+// Acquire takes a slot for key, waiting for it until ctx is done.
+func (s *FairSemaphore) Acquire(ctx context.Context, key string) error {
+	s.Lock()
+	if s.used < s.size && len(s.order) == 0 {
+		s.used++
+		s.Unlock()
+		return nil
+	}
+
+	ready := make(chan struct{})
+	if len(s.waiters[key]) == 0 {
+		s.order = append(s.order, key)
+	}
+	s.waiters[key] = append(s.waiters[key], ready)
+	s.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	select {
+	case <-ready:
+		// the slot was handed over meanwhile, give it to the next one.
+		s.release()
+	default:
+		s.remove(key, ready)
+	}
+	return ctx.Err()
+}
+
+// Release frees a slot taken with Acquire.
+func (s *FairSemaphore) Release() {
+	s.Lock()
+	s.release()
+	s.Unlock()
+}
+
+// release hands the slot to the first waiter of the next key.
+// Must be called with lock held.
+func (s *FairSemaphore) release() {
+	if len(s.order) == 0 {
+		s.used--
+		return
+	}
+
+	key := s.order[0]
+	queue := s.waiters[key]
+	ready := queue[0]
+	s.order = s.order[1:]
+	if len(queue) == 1 {
+		delete(s.waiters, key)
+	} else {
+		s.waiters[key] = queue[1:]
+		s.order = append(s.order, key)
+	}
+	close(ready)
+}
+
+// remove drops a waiter which left.
+// Must be called with lock held.
+func (s *FairSemaphore) remove(key string, ready chan struct{}) {
+	queue := s.waiters[key]
+	for i, ch := range queue {
+		if ch == ready {
+			queue = append(queue[:i], queue[i+1:]...)
+			break
+		}
+	}
+	if len(queue) > 0 {
+		s.waiters[key] = queue
+		return
+	}
+
+	delete(s.waiters, key)
+	for i, k := range s.order {
+		if k == key {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+}
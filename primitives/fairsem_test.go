@@ -0,0 +1,54 @@
+package primitives
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFairSemaphore(t *testing.T) {
+	sem := NewFairSemaphore(1)
+	ctx := context.Background()
+	if err := sem.Acquire(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu      sync.Mutex
+		granted []string
+		wg      sync.WaitGroup
+	)
+	wait := func(key string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem.Acquire(ctx, key)
+			mu.Lock()
+			granted = append(granted, key)
+			mu.Unlock()
+			sem.Release()
+		}()
+
+		// queue the waiters in order.
+		time.Sleep(time.Millisecond * 20)
+	}
+	wait("a")
+	wait("a")
+	wait("a")
+	wait("b")
+
+	// a waiter which leaves gives its turn up.
+	leaving, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := sem.Acquire(leaving, "c"); err == nil {
+		t.Fatal("expect cancelled acquire to fail")
+	}
+
+	sem.Release()
+	wg.Wait()
+	if expected := []string{"a", "b", "a", "a"}; !reflect.DeepEqual(granted, expected) {
+		t.Fatalf("expect the keys served in turn %v. Got %v", expected, granted)
+	}
+}
@@ -0,0 +1,91 @@
+package primitives
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// NewTokenBucket returns a token bucket which allows rate events per second with bursts up to burst.
+// A rate <= 0 disables limiting, the bucket can still be blocked with Block.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// TokenBucket is a simple thread safe token bucket rate limiter.
+type TokenBucket struct {
+	sync.Mutex
+
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	blockedUntil time.Time
+}
+
+// Wait blocks until a token is available or ctx is done.
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	for {
+		wait := b.reserve()
+		if wait <= 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Block stops handing out tokens for the duration d.
+func (b *TokenBucket) Block(d time.Duration) {
+	b.Lock()
+	defer b.Unlock()
+
+	until := time.Now().Add(d)
+	if until.After(b.blockedUntil) {
+		b.blockedUntil = until
+	}
+}
+
+// reserve takes a token and returns 0 or returns the time to wait before trying again.
+func (b *TokenBucket) reserve() time.Duration {
+	b.Lock()
+	defer b.Unlock()
+
+	now := time.Now()
+	if now.Before(b.blockedUntil) {
+		return b.blockedUntil.Sub(now)
+	}
+
+	if b.rate <= 0 {
+		return 0
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
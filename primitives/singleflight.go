@@ -0,0 +1,100 @@
+package primitives
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// NewGroup returns a group which runs a single call per key at a time.
+func NewGroup() *Group {
+	return &Group{
+		calls: make(map[string]*call),
+	}
+}
+
+// Group deduplicates the concurrent calls with the same key: the first caller runs the function,
+// the others wait for it and share its result.
+type Group struct {
+	sync.Mutex
+
+	calls map[string]*call
+
+	// counters of the calls made and the calls which got a shared result.
+	made, shared uint64
+}
+
+// call is a call in flight.
+type call struct {
+	done chan struct{}
+	val  interface{}
+	err  error
+
+	// waiters is the number of callers still waiting, the call is cancelled when all of them leave.
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// Do runs fn once for all the concurrent callers with the same key and returns its result,
+// shared is true if the result was made for another caller.
+// fn gets the values of the first caller's ctx, it is cancelled only when all callers' contexts are done,
+// so a caller leaving early does not fail the others.
+func (g *Group) Do(ctx context.Context, key string, fn func(context.Context) (interface{}, error)) (v interface{}, err error, shared bool) {
+	g.Lock()
+	c, ok := g.calls[key]
+	if ok {
+		c.waiters++
+		g.Unlock()
+		atomic.AddUint64(&g.shared, 1)
+		return g.wait(ctx, key, c, true)
+	}
+
+	callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	c = &call{
+		done:    make(chan struct{}),
+		waiters: 1,
+		cancel:  cancel,
+	}
+	g.calls[key] = c
+	g.Unlock()
+	atomic.AddUint64(&g.made, 1)
+
+	go func() {
+		c.val, c.err = fn(callCtx)
+
+		g.Lock()
+		if g.calls[key] == c {
+			delete(g.calls, key)
+		}
+		g.Unlock()
+		cancel()
+		close(c.done)
+	}()
+
+	return g.wait(ctx, key, c, false)
+}
+
+func (g *Group) wait(ctx context.Context, key string, c *call, shared bool) (interface{}, error, bool) {
+	select {
+	case <-c.done:
+		return c.val, c.err, shared
+	case <-ctx.Done():
+	}
+
+	g.Lock()
+	c.waiters--
+	if c.waiters == 0 {
+		// nobody waits for the result, the next caller starts a new call.
+		if g.calls[key] == c {
+			delete(g.calls, key)
+		}
+		c.cancel()
+	}
+	g.Unlock()
+	return nil, ctx.Err(), shared
+}
+
+// Stats returns the number of calls made and the number of callers which shared a result of another.
+func (g *Group) Stats() (made, shared uint64) {
+	return atomic.LoadUint64(&g.made), atomic.LoadUint64(&g.shared)
+}
@@ -0,0 +1,185 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/darkonie/wikiracer/control"
+	"github.com/darkonie/wikiracer/worker"
+	"github.com/sirupsen/logrus"
+)
+
+// default upstream limits, wikimedia recommends maxlag=5.
+var (
+	defaultRateLimit  = 20.0
+	defaultRateBurst  = 20
+	defaultMaxLag     = 5
+	defaultMaxRetries = 3
+
+	defaultCacheTTL    = time.Hour * 24
+	defaultCacheSizeMB = 1024
+)
+
+// loadConfig reads the server configuration from environment variables.
+func loadConfig() (control.Config, error) {
+	clients, err := loadClientProfiles()
+	if err != nil {
+		return control.Config{}, err
+	}
+
+	var store control.JobStore
+	if dir := os.Getenv("WIKI_STORE_DIR"); dir != "" {
+		if store, err = control.NewFileStore(dir); err != nil {
+			return control.Config{}, err
+		}
+	}
+
+	return control.Config{
+		Limits: worker.LimitConfig{
+			Rate:       envFloat("WIKI_RATE_LIMIT", defaultRateLimit),
+			Burst:      envInt("WIKI_RATE_BURST", defaultRateBurst),
+			MaxLag:     envInt("WIKI_MAXLAG", defaultMaxLag),
+			MaxRetries: envInt("WIKI_MAX_RETRIES", defaultMaxRetries),
+		},
+		Retry: control.RetryPolicy{
+			MaxAttempts: envInt("WIKI_FETCH_ATTEMPTS", control.DefaultRetryPolicy.MaxAttempts),
+			Backoff:     envDuration("WIKI_FETCH_BACKOFF", control.DefaultRetryPolicy.Backoff),
+		},
+		Cache: worker.CacheConfig{
+			Dir:     os.Getenv("WIKI_CACHE_DIR"),
+			TTL:     envDuration("WIKI_CACHE_TTL", defaultCacheTTL),
+			MaxSize: int64(envInt("WIKI_CACHE_SIZE_MB", defaultCacheSizeMB)) << 20,
+		},
+		RecordDir:          os.Getenv("WIKI_RECORD_DIR"),
+		ReplayDir:          os.Getenv("WIKI_REPLAY_DIR"),
+		Middleware:         envList("WIKI_CRAWLER_MIDDLEWARE"),
+		FetchTimeout:       envDuration("WIKI_FETCH_TIMEOUT", 0),
+		BreakerThreshold:   envInt("WIKI_BREAKER_THRESHOLD", 0),
+		BreakerCooldown:    envDuration("WIKI_BREAKER_COOLDOWN", 0),
+		FetchRate:          envFloat("WIKI_FETCH_RATE", 0),
+		Clients:            clients,
+		Store:              store,
+		IgnoreRobots:       !envBool("WIKI_ROBOTS", true),
+		RobotsTTL:          envDuration("WIKI_ROBOTS_TTL", 0),
+		CheckpointInterval: envDuration("WIKI_CHECKPOINT_INTERVAL", 0),
+		Retention: control.RetentionPolicy{
+			MaxAge:    envDuration("WIKI_RETENTION_MAX_AGE", 0),
+			MaxJobs:   envInt("WIKI_RETENTION_MAX_JOBS", 0),
+			MaxMemory: int64(envInt("WIKI_RETENTION_MAX_MEMORY_MB", 0)) << 20,
+		},
+		MaxWorkers:    envInt("WIKI_MAX_WORKERS", 0),
+		MinJobWorkers: envInt("WIKI_MIN_JOB_WORKERS", 0),
+	}, nil
+}
+
+// loadClientProfiles reads the named client profiles from a JSON file in WIKI_CLIENT_PROFILES
+// and applies the WIKI_USER_AGENT, WIKI_HTTP_* variables to the default profile.
+func loadClientProfiles() (map[string]worker.ClientProfile, error) {
+	profiles := map[string]worker.ClientProfile{}
+	if file := os.Getenv("WIKI_CLIENT_PROFILES"); file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read client profiles: %s", err)
+		}
+
+		if err := json.Unmarshal(data, &profiles); err != nil {
+			return nil, fmt.Errorf("unable to parse client profiles %s: %s", file, err)
+		}
+	}
+
+	def := profiles[control.DefaultClientProfile]
+	envString := func(v *string, name string) {
+		if s := os.Getenv(name); s != "" {
+			*v = s
+		}
+	}
+	envString(&def.UserAgent, "WIKI_USER_AGENT")
+	envString(&def.Proxy, "WIKI_HTTP_PROXY")
+	envString(&def.CAFile, "WIKI_HTTP_CA_FILE")
+	envString(&def.Timeout, "WIKI_HTTP_TIMEOUT")
+	def.MaxIdleConnsPerHost = envInt("WIKI_HTTP_MAX_IDLE_CONNS_PER_HOST", def.MaxIdleConnsPerHost)
+	def.MaxConnsPerHost = envInt("WIKI_HTTP_MAX_CONNS_PER_HOST", def.MaxConnsPerHost)
+	if os.Getenv("WIKI_HTTP_DISABLE_HTTP2") != "" {
+		disable := true
+		def.DisableHTTP2 = &disable
+	}
+	profiles[control.DefaultClientProfile] = def
+	return profiles, nil
+}
+
+// envList parses a comma separated list, returns nil if the variable is not set.
+func envList(name string) []string {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return nil
+	}
+
+	list := []string{}
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func envInt(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		logrus.Errorf("unable to parse %s, using default %d", name, def)
+		return def
+	}
+	return i
+}
+
+func envFloat(name string, def float64) float64 {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		logrus.Errorf("unable to parse %s, using default %g", name, def)
+		return def
+	}
+	return f
+}
+
+func envBool(name string, def bool) bool {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		logrus.Errorf("unable to parse %s, using default %t", name, def)
+		return def
+	}
+	return b
+}
+
+func envDuration(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		logrus.Errorf("unable to parse %s, using default %s", name, def)
+		return def
+	}
+	return d
+}
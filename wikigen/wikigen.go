@@ -0,0 +1,268 @@
+// Package wikigen generates synthetic wiki link graphs for load testing and ground truth checks.
+// A generated Graph can be used as a worker.WikiCrawler or as a fakewiki server backend.
+package wikigen
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/darkonie/wikiracer/worker"
+)
+
+// Shape defines how the pages are linked.
+type Shape int
+
+const (
+	// Random links every page to uniformly chosen pages.
+	Random Shape = iota
+
+	// PowerLaw uses preferential attachment, so a few hub pages get most of the links.
+	PowerLaw
+
+	// SmallWorld is a ring lattice with randomly rewired links.
+	SmallWorld
+)
+
+// titlePrefix is used to name the generated pages, e.g. "Page 42".
+const titlePrefix = "Page "
+
+// Options describes a graph to generate.
+type Options struct {
+	// Pages is the number of pages.
+	Pages int
+
+	// Degree is the average number of links per page.
+	Degree int
+
+	// Shape of the graph.
+	Shape Shape
+
+	// Rewire is the probability to rewire a link in SmallWorld graph. Default 0.1.
+	Rewire float64
+
+	// Seed makes the generated graph reproducible.
+	Seed int64
+}
+
+// New generates a new graph.
+func New(opts Options) *Graph {
+	if opts.Degree <= 0 {
+		opts.Degree = 10
+	}
+	if opts.Rewire <= 0 {
+		opts.Rewire = 0.1
+	}
+
+	g := &Graph{
+		rnd:   rand.New(rand.NewSource(opts.Seed)),
+		links: make([][]int32, opts.Pages),
+	}
+
+	switch opts.Shape {
+	case PowerLaw:
+		g.powerLaw(opts.Degree)
+	case SmallWorld:
+		g.smallWorld(opts.Degree, opts.Rewire)
+	default:
+		g.random(opts.Degree)
+	}
+
+	return g
+}
+
+// Graph is a generated link graph.
+type Graph struct {
+	rnd   *rand.Rand
+	links [][]int32
+}
+
+func (g *Graph) random(degree int) {
+	n := len(g.links)
+	for i := range g.links {
+		for k := 0; k < degree && n > 1; k++ {
+			g.link(i, g.rnd.Intn(n))
+		}
+	}
+}
+
+func (g *Graph) powerLaw(degree int) {
+	// every page appears in targets once per incoming link plus once, so the chance
+	// to be linked grows with the number of links.
+	targets := make([]int32, 0, len(g.links)*(degree+1))
+	for i := range g.links {
+		if i > 0 {
+			for k := 0; k < degree; k++ {
+				t := int(targets[g.rnd.Intn(len(targets))])
+				g.link(i, t)
+				targets = append(targets, int32(t))
+
+				// hubs link back, so the old pages can reach the new ones.
+				if g.rnd.Intn(2) == 0 {
+					g.link(t, i)
+				}
+			}
+		}
+		targets = append(targets, int32(i))
+	}
+}
+
+func (g *Graph) smallWorld(degree int, rewire float64) {
+	n := len(g.links)
+	half := degree / 2
+	if half < 1 {
+		half = 1
+	}
+
+	for i := range g.links {
+		for k := 1; k <= half; k++ {
+			for _, t := range []int{(i + k) % n, (i - k + n) % n} {
+				if g.rnd.Float64() < rewire {
+					t = g.rnd.Intn(n)
+				}
+				g.link(i, t)
+			}
+		}
+	}
+}
+
+func (g *Graph) link(from, to int) {
+	if from == to {
+		return
+	}
+	g.links[from] = append(g.links[from], int32(to))
+}
+
+func (g *Graph) add() int {
+	g.links = append(g.links, nil)
+	return len(g.links) - 1
+}
+
+// Plant adds a path of known length between 2 new pages and returns their titles.
+// The only way from the first page to the second one is the planted path, so the distance
+// between them is exactly length. The path is connected to the rest of the graph.
+// Plant must be called before the graph is used.
+func (g *Graph) Plant(length int) (string, string) {
+	n := len(g.links)
+	from := g.add()
+
+	// the rest of the graph can link to the start page, but the start page only links to the path.
+	for k := 0; k < 3 && n > 0; k++ {
+		g.link(g.rnd.Intn(n), from)
+	}
+
+	prev := from
+	for i := 1; i <= length; i++ {
+		next := g.add()
+		g.link(prev, next)
+
+		// the path pages can link out, no shortcuts are possible since nothing links in.
+		if i < length && n > 0 {
+			g.link(next, g.rnd.Intn(n))
+		}
+		prev = next
+	}
+
+	return Title(from), Title(prev)
+}
+
+// Len returns the number of pages.
+func (g *Graph) Len() int {
+	return len(g.links)
+}
+
+// Title returns a title of i-th page.
+func Title(i int) string {
+	return titlePrefix + strconv.Itoa(i)
+}
+
+func (g *Graph) index(title string) (int, bool) {
+	if !strings.HasPrefix(title, titlePrefix) {
+		return 0, false
+	}
+
+	i, err := strconv.Atoi(title[len(titlePrefix):])
+	if err != nil || i < 0 || i >= len(g.links) {
+		return 0, false
+	}
+	return i, true
+}
+
+// Links returns the links of a page, implements fakewiki.Graph interface.
+func (g *Graph) Links(title string) ([]string, bool) {
+	i, ok := g.index(title)
+	if !ok {
+		return nil, false
+	}
+
+	links := make([]string, 0, len(g.links[i]))
+	for _, l := range g.links[i] {
+		links = append(links, Title(int(l)))
+	}
+	return links, true
+}
+
+// Distance returns the number of links on the shortest path between 2 pages or -1 if there is no path.
+func (g *Graph) Distance(from, to string) int {
+	src, ok := g.index(from)
+	if !ok {
+		return -1
+	}
+
+	dst, ok := g.index(to)
+	if !ok {
+		return -1
+	}
+
+	dist := make([]int32, len(g.links))
+	for i := range dist {
+		dist[i] = -1
+	}
+	dist[src] = 0
+
+	queue := []int32{int32(src)}
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		if int(i) == dst {
+			return int(dist[i])
+		}
+
+		for _, l := range g.links[i] {
+			if dist[l] < 0 {
+				dist[l] = dist[i] + 1
+				queue = append(queue, l)
+			}
+		}
+	}
+
+	return -1
+}
+
+// Crawler returns a crawler which fetches the pages from the graph.
+func (g *Graph) Crawler() worker.WikiCrawler {
+	return &crawler{graph: g}
+}
+
+type crawler struct {
+	graph *Graph
+}
+
+// Fetch implements worker.WikiCrawler interface.
+func (c *crawler) Fetch(ctx context.Context, link string) (*worker.Page, error) {
+	i, ok := c.graph.index(link)
+	if !ok {
+		return nil, fmt.Errorf("page %s does not exist", link)
+	}
+
+	page := &worker.Page{
+		Name:  link,
+		Links: make(map[string]bool, len(c.graph.links[i])),
+	}
+	for _, l := range c.graph.links[i] {
+		page.Links[Title(int(l))] = true
+	}
+	return page, nil
+}
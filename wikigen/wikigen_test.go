@@ -0,0 +1,33 @@
+package wikigen
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	for _, shape := range []Shape{Random, PowerLaw, SmallWorld} {
+		g := New(Options{Pages: 1000, Degree: 6, Shape: shape, Seed: 1})
+		from, to := g.Plant(7)
+
+		if g.Len() != 1008 {
+			t.Fatalf("shape %d: expect 1008 pages. Got %d", shape, g.Len())
+		}
+
+		if d := g.Distance(from, to); d != 7 {
+			t.Fatalf("shape %d: expect planted distance 7. Got %d", shape, d)
+		}
+
+		if d := g.Distance(Title(0), from); d < 0 {
+			t.Fatalf("shape %d: expect planted path to be reachable", shape)
+		}
+
+		page, err := g.Crawler().Fetch(context.Background(), from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Links) != 1 {
+			t.Fatalf("shape %d: expect 1 link from planted page. Got %v", shape, page.Links)
+		}
+	}
+}
@@ -2,14 +2,10 @@ package worker
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
-	"strings"
-
-	"github.com/sirupsen/logrus"
+	"strconv"
+	"time"
 )
 
 // WikiCrawler defines a wiki crawler interface
@@ -17,8 +13,25 @@ type WikiCrawler interface {
 	Fetch(context.Context, string) (*Page, error)
 }
 
+func init() {
+	Register("api", Factory{
+		Description: "reads the page links from MediaWiki action API (/w/api.php)",
+		Options:     []OptionSpec{hostOption},
+		New: func(env Env, opts Options) WikiCrawler {
+			c := newAPIWikiCrawler(env.Client)
+			c.endpoint = withHost(c.endpoint, opts)
+			return c
+		},
+		Resolve: resolveWikiTitle(nil),
+	})
+}
+
 // NewAPIWikiCrawler is a apiWikiCrawler constructor.
 func NewAPIWikiCrawler(client *http.Client) WikiCrawler {
+	return newAPIWikiCrawler(client)
+}
+
+func newAPIWikiCrawler(client *http.Client) *apiWikiCrawler {
 	return &apiWikiCrawler{
 		client: client,
 		endpoint: url.URL{
@@ -37,7 +50,12 @@ type apiWikiCrawler struct {
 }
 
 // Fetch takes a wiki Link and returns wiki Page.
+// If the context has a time set with WithAsOf the links are read from the revision current at that time.
 func (c *apiWikiCrawler) Fetch(ctx context.Context, link string) (*Page, error) {
+	if t, ok := AsOf(ctx); ok {
+		return c.fetchRevision(ctx, link, t)
+	}
+
 	page := &Page{
 		Name:  link,
 		Links: make(map[string]bool),
@@ -52,8 +70,12 @@ func (c *apiWikiCrawler) Fetch(ctx context.Context, link string) (*Page, error)
 		Query struct {
 			Pages map[string]struct {
 				Links []struct {
+					Ns    int    `json:"ns"`
 					Title string `json:"title"`
 				} `json:"links"`
+				PageProps struct {
+					Disambiguation *string `json:"disambiguation"`
+				} `json:"pageprops"`
 			} `json:"pages"`
 		} `json:"query"`
 	}
@@ -62,48 +84,26 @@ func (c *apiWikiCrawler) Fetch(ctx context.Context, link string) (*Page, error)
 	for {
 		v := url.Values{}
 		v.Add("action", "query")
-		v.Add("format", "json")
-		v.Add("prop", "links")
+		v.Add("prop", "links|pageprops")
+		v.Add("ppprop", "disambiguation")
 		v.Add("pllimit", "500")
 		v.Add("titles", string(link))
 		if cont != "" {
 			v.Add("plcontinue", cont)
 		}
 
-		wikiURL := c.endpoint
-		wikiURL.RawQuery = v.Encode()
-		logrus.Debugf("GET %s", wikiURL.String())
-
-		req, err := http.NewRequest("GET", wikiURL.String(), nil)
-		if err != nil {
-			return nil, fmt.Errorf("unable to make a new request: %s", err)
-		}
-
-		resp, err := c.client.Do(req.WithContext(ctx))
-		if err != nil {
-			return nil, err
-		}
-
-		if resp.StatusCode != http.StatusOK {
-			resp.Body.Close()
-			return nil, fmt.Errorf("bad response: %d", resp.StatusCode)
-		}
-
 		r := &response{}
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			resp.Body.Close()
-			return nil, fmt.Errorf("unable to read response: %s", err)
-		}
-		resp.Body.Close()
-
-		if err := json.Unmarshal(body, r); err != nil {
-			return nil, fmt.Errorf("unable to unmarshal response: %s", err)
+		if err := queryAPI(ctx, c.client, c.endpoint, v, r); err != nil {
+			return nil, err
 		}
 
 		for _, p := range r.Query.Pages {
+			if p.PageProps.Disambiguation != nil {
+				page.Disambiguation = true
+			}
+
 			for _, l := range p.Links {
-				if strings.Contains(l.Title, ":") {
+				if l.Ns != NamespaceMain {
 					continue
 				}
 
@@ -121,3 +121,51 @@ func (c *apiWikiCrawler) Fetch(ctx context.Context, link string) (*Page, error)
 
 	return page, nil
 }
+
+// fetchRevision returns the page with the links of the revision which was current at the time t.
+func (c *apiWikiCrawler) fetchRevision(ctx context.Context, link string, t time.Time) (*Page, error) {
+	revID, err := resolveRevision(ctx, c.client, c.endpoint, link, t)
+	if err != nil {
+		return nil, err
+	}
+
+	var r struct {
+		Parse struct {
+			Links []struct {
+				Ns    int    `json:"ns"`
+				Title string `json:"*"`
+			} `json:"links"`
+			Properties []struct {
+				Name string `json:"name"`
+			} `json:"properties"`
+		} `json:"parse"`
+	}
+
+	v := url.Values{}
+	v.Set("action", "parse")
+	v.Set("oldid", strconv.FormatInt(revID, 10))
+	v.Set("prop", "links|properties")
+	if err := queryAPI(ctx, c.client, c.endpoint, v, &r); err != nil {
+		return nil, err
+	}
+
+	page := &Page{
+		Name:  link,
+		Links: make(map[string]bool),
+	}
+
+	for _, p := range r.Parse.Properties {
+		if p.Name == "disambiguation" {
+			page.Disambiguation = true
+		}
+	}
+
+	for _, l := range r.Parse.Links {
+		if l.Ns != NamespaceMain {
+			continue
+		}
+		page.Links[l.Title] = true
+	}
+
+	return page, nil
+}
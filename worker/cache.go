@@ -0,0 +1,297 @@
+package worker
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// CacheConfig describes the on disk link cache.
+type CacheConfig struct {
+	// Dir is a directory to store the cached pages in.
+	Dir string
+
+	// TTL is how long a cached page is valid. 0 means forever.
+	TTL time.Duration
+
+	// MaxSize is the maximum size of the cache in bytes. 0 means unlimited.
+	MaxSize int64
+}
+
+// CacheStats describes the cache usage.
+type CacheStats struct {
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Entries int    `json:"entries"`
+	Size    int64  `json:"size"`
+}
+
+// cacheTempPrefix is the name prefix of the pages being written.
+const cacheTempPrefix = "tmp"
+
+// NewLinkCache opens a link cache in cfg.Dir, the directory is created if needed.
+// Expired entries left from the previous runs are removed.
+func NewLinkCache(cfg CacheConfig) (*LinkCache, error) {
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create cache dir: %s", err)
+	}
+
+	files, err := ioutil.ReadDir(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read cache dir: %s", err)
+	}
+
+	c := &LinkCache{
+		cfg:     cfg,
+		entries: make(map[string]cacheEntry),
+	}
+
+	for _, f := range files {
+		// a page being written when the server stopped.
+		if !f.IsDir() && strings.HasPrefix(f.Name(), cacheTempPrefix) {
+			os.Remove(filepath.Join(cfg.Dir, f.Name()))
+			continue
+		}
+
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+
+		if c.expired(f.ModTime()) {
+			os.Remove(filepath.Join(cfg.Dir, f.Name()))
+			continue
+		}
+
+		c.entries[f.Name()] = cacheEntry{size: f.Size(), stored: f.ModTime()}
+		c.size += f.Size()
+	}
+
+	c.Lock()
+	c.evict()
+	c.Unlock()
+	return c, nil
+}
+
+// LinkCache stores the crawled pages on a local disk, so they survive restarts and
+// can be shared by all jobs.
+type LinkCache struct {
+	sync.Mutex
+
+	cfg     CacheConfig
+	entries map[string]cacheEntry
+	size    int64
+
+	hits, misses uint64
+}
+
+type cacheEntry struct {
+	size   int64
+	stored time.Time
+}
+
+// cachedPage is a page representation stored on disk.
+type cachedPage struct {
+	Name           string   `json:"name"`
+	Links          []string `json:"links"`
+	Disambiguation bool     `json:"disambiguation,omitempty"`
+
+	Anchors map[string]Anchor `json:"anchors,omitempty"`
+}
+
+// Get returns a cached page by key.
+func (c *LinkCache) Get(key string) (*Page, bool) {
+	page, ok := c.get(c.filename(key))
+	if ok {
+		atomic.AddUint64(&c.hits, 1)
+	} else {
+		atomic.AddUint64(&c.misses, 1)
+	}
+	return page, ok
+}
+
+func (c *LinkCache) get(name string) (*Page, bool) {
+	c.Lock()
+	e, ok := c.entries[name]
+	if ok && c.expired(e.stored) {
+		c.remove(name)
+		ok = false
+	}
+	c.Unlock()
+
+	if !ok {
+		return nil, false
+	}
+
+	body, err := ioutil.ReadFile(filepath.Join(c.cfg.Dir, name))
+	if err != nil {
+		return nil, false
+	}
+
+	cp := &cachedPage{}
+	if err := json.Unmarshal(body, cp); err != nil {
+		logrus.Errorf("unable to unmarshal cached page %s: %s", name, err)
+		return nil, false
+	}
+
+	page := &Page{
+		Name:           cp.Name,
+		Links:          make(map[string]bool, len(cp.Links)),
+		Disambiguation: cp.Disambiguation,
+		Anchors:        cp.Anchors,
+	}
+	for _, l := range cp.Links {
+		page.Links[l] = true
+	}
+	return page, true
+}
+
+// Put stores a page by key.
+func (c *LinkCache) Put(key string, page *Page) error {
+	cp := &cachedPage{
+		Name:           page.Name,
+		Links:          make([]string, 0, len(page.Links)),
+		Disambiguation: page.Disambiguation,
+		Anchors:        page.Anchors,
+	}
+	for l := range page.Links {
+		cp.Links = append(cp.Links, l)
+	}
+
+	body, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	name := c.filename(key)
+	tmp, err := ioutil.TempFile(c.cfg.Dir, cacheTempPrefix)
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(c.cfg.Dir, name))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if e, ok := c.entries[name]; ok {
+		c.size -= e.size
+	}
+	c.entries[name] = cacheEntry{size: int64(len(body)), stored: time.Now()}
+	c.size += int64(len(body))
+	c.evict()
+	return nil
+}
+
+// Stats returns the cache usage stats.
+func (c *LinkCache) Stats() CacheStats {
+	c.Lock()
+	defer c.Unlock()
+	return CacheStats{
+		Hits:    atomic.LoadUint64(&c.hits),
+		Misses:  atomic.LoadUint64(&c.misses),
+		Entries: len(c.entries),
+		Size:    c.size,
+	}
+}
+
+func (c *LinkCache) filename(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return hex.EncodeToString(sum[:]) + ".json"
+}
+
+func (c *LinkCache) expired(stored time.Time) bool {
+	return c.cfg.TTL > 0 && time.Since(stored) > c.cfg.TTL
+}
+
+// remove must be called with lock held.
+func (c *LinkCache) remove(name string) {
+	e, ok := c.entries[name]
+	if !ok {
+		return
+	}
+	delete(c.entries, name)
+	c.size -= e.size
+	os.Remove(filepath.Join(c.cfg.Dir, name))
+}
+
+// evict removes the oldest entries until the cache fits in MaxSize. Must be called with lock held.
+func (c *LinkCache) evict() {
+	if c.cfg.MaxSize <= 0 || c.size <= c.cfg.MaxSize {
+		return
+	}
+
+	names := make([]string, 0, len(c.entries))
+	for name := range c.entries {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return c.entries[names[i]].stored.Before(c.entries[names[j]].stored)
+	})
+
+	// free some space, so we don't evict on every put.
+	limit := c.cfg.MaxSize - c.cfg.MaxSize/10
+	for _, name := range names {
+		if c.size <= limit {
+			break
+		}
+		c.remove(name)
+	}
+}
+
+// NewCachingCrawler returns a crawler which looks up the pages in cache before fetching them with next.
+// The prefix separates the pages fetched by different crawl methods.
+func NewCachingCrawler(next WikiCrawler, cache *LinkCache, prefix string) WikiCrawler {
+	return &cachingCrawler{
+		next:   next,
+		cache:  cache,
+		prefix: prefix,
+	}
+}
+
+type cachingCrawler struct {
+	next   WikiCrawler
+	cache  *LinkCache
+	prefix string
+}
+
+// Fetch returns a cached page or fetches and caches a new one.
+func (c *cachingCrawler) Fetch(ctx context.Context, link string) (*Page, error) {
+	key := c.prefix + ":" + link
+	if t, ok := AsOf(ctx); ok {
+		key += "@" + t.UTC().Format(time.RFC3339)
+	}
+	if page, ok := c.cache.Get(key); ok {
+		return page, nil
+	}
+
+	page, err := c.next.Fetch(ctx, link)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.cache.Put(key, page); err != nil {
+		logrus.Errorf("unable to cache page %s: %s", link, err)
+	}
+	return page, nil
+}
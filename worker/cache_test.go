@@ -0,0 +1,70 @@
+package worker
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+type countingCrawler struct {
+	calls int
+}
+
+func (c *countingCrawler) Fetch(ctx context.Context, link string) (*Page, error) {
+	c.calls++
+	return &Page{Name: link, Links: map[string]bool{"AAA": true, "BBB": true}}, nil
+}
+
+func TestCachingCrawler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "linkcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache, err := NewLinkCache(CacheConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := &countingCrawler{}
+	crawler := NewCachingCrawler(next, cache, "api")
+	for i := 0; i < 3; i++ {
+		page, err := crawler.Fetch(context.Background(), "Mike Tyson")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Links) != 2 || !page.Links["BBB"] {
+			t.Fatalf("unexpected links %v", page.Links)
+		}
+	}
+
+	if next.calls != 1 {
+		t.Fatalf("expect 1 upstream fetch. Got %d", next.calls)
+	}
+
+	// a page which was being written when the server crashed.
+	tmp, err := ioutil.TempFile(dir, cacheTempPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp.Close()
+
+	// reopen the cache as it would be after restart.
+	cache, err = NewLinkCache(CacheConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(tmp.Name()); !os.IsNotExist(err) {
+		t.Fatalf("expect stale temp file removed. Got %v", err)
+	}
+	if _, ok := cache.Get("api:Mike Tyson"); !ok {
+		t.Fatal("expect page to survive restart")
+	}
+
+	stats := cache.Stats()
+	if stats.Entries != 1 || stats.Hits != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
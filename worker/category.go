@@ -0,0 +1,369 @@
+package worker
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// categoryPrefix is the prefix of category page titles.
+const categoryPrefix = "Category:"
+
+// CategoryTitle returns the normalized title of a category page, e.g. Physics -> Category:Physics.
+func CategoryTitle(name string) string {
+	name = strings.TrimSpace(strings.Replace(name, "_", " ", -1))
+	if !strings.HasPrefix(name, categoryPrefix) {
+		name = categoryPrefix + name
+	}
+	return name
+}
+
+// NewCategoryIndex returns a category index of the MediaWiki site on the endpoint host.
+// The page categories are kept in cache if it is not nil, so they are shared by all jobs
+// and survive restarts.
+func NewCategoryIndex(client *http.Client, endpoint url.URL, cache *LinkCache) *CategoryIndex {
+	return &CategoryIndex{
+		client:   client,
+		endpoint: apiEndpoint(endpoint),
+		cache:    cache,
+		memo:     make(map[string][]string),
+	}
+}
+
+// CategoryIndex looks up page categories with prop=categories and subcategories with list=categorymembers.
+type CategoryIndex struct {
+	sync.Mutex
+
+	client   *http.Client
+	endpoint url.URL
+	cache    *LinkCache
+
+	// memo keeps the categories of the pages looked up without cache.
+	memo map[string][]string
+}
+
+// maxMemo limits the number of pages memoized by the index.
+const maxMemo = 100000
+
+func (x *CategoryIndex) cacheKey(title string) string {
+	return "categories:" + x.endpoint.Host + ":" + title
+}
+
+func (x *CategoryIndex) cached(title string) ([]string, bool) {
+	if x.cache != nil {
+		page, ok := x.cache.Get(x.cacheKey(title))
+		if !ok {
+			return nil, false
+		}
+
+		categories := make([]string, 0, len(page.Links))
+		for c := range page.Links {
+			categories = append(categories, c)
+		}
+		return categories, true
+	}
+
+	x.Lock()
+	defer x.Unlock()
+	categories, ok := x.memo[title]
+	return categories, ok
+}
+
+func (x *CategoryIndex) store(title string, categories []string) {
+	if x.cache != nil {
+		page := &Page{Name: title, Links: make(map[string]bool, len(categories))}
+		for _, c := range categories {
+			page.Links[c] = true
+		}
+		if err := x.cache.Put(x.cacheKey(title), page); err != nil {
+			logrus.Errorf("unable to cache categories of %s: %s", title, err)
+		}
+		return
+	}
+
+	x.Lock()
+	defer x.Unlock()
+	if len(x.memo) >= maxMemo {
+		x.memo = make(map[string][]string)
+	}
+	x.memo[title] = categories
+}
+
+// Categories returns the categories of the pages by title. Missing pages have no categories.
+func (x *CategoryIndex) Categories(ctx context.Context, titles []string) (map[string][]string, error) {
+	result := make(map[string][]string, len(titles))
+	var missing []string
+	for _, t := range titles {
+		if categories, ok := x.cached(t); ok {
+			result[t] = categories
+			continue
+		}
+		missing = append(missing, t)
+	}
+
+	for len(missing) > 0 {
+		n := apiBatch
+		if n > len(missing) {
+			n = len(missing)
+		}
+
+		found, err := pageCategories(ctx, x.client, x.endpoint, missing[:n], true)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, t := range missing[:n] {
+			result[t] = found[t]
+			x.store(t, found[t])
+		}
+		missing = missing[n:]
+	}
+	return result, nil
+}
+
+// pageCategories fetches the categories of at most apiBatch pages, including the hidden ones if hidden is true.
+func pageCategories(ctx context.Context, client *http.Client, endpoint url.URL, titles []string, hidden bool) (map[string][]string, error) {
+	type response struct {
+		Continue struct {
+			Clcontinue string `json:"clcontinue"`
+		} `json:"continue"`
+
+		Query struct {
+			Normalized []struct {
+				From string `json:"from"`
+				To   string `json:"to"`
+			} `json:"normalized"`
+			Pages map[string]struct {
+				Title      string `json:"title"`
+				Categories []struct {
+					Title string `json:"title"`
+				} `json:"categories"`
+			} `json:"pages"`
+		} `json:"query"`
+	}
+
+	found := make(map[string][]string, len(titles))
+	var cont string
+	for {
+		v := url.Values{}
+		v.Set("action", "query")
+		v.Set("prop", "categories")
+		v.Set("cllimit", "max")
+		v.Set("titles", strings.Join(titles, "|"))
+		if !hidden {
+			v.Set("clshow", "!hidden")
+		}
+		if cont != "" {
+			v.Set("clcontinue", cont)
+		}
+
+		r := &response{}
+		if err := queryAPI(ctx, client, endpoint, v, r); err != nil {
+			return nil, err
+		}
+
+		// the response has the normalized titles, map them back to the requested ones.
+		requested := map[string]string{}
+		for _, n := range r.Query.Normalized {
+			requested[n.To] = n.From
+		}
+
+		for _, p := range r.Query.Pages {
+			title := p.Title
+			if from, ok := requested[title]; ok {
+				title = from
+			}
+			for _, c := range p.Categories {
+				found[title] = append(found[title], c.Title)
+			}
+		}
+
+		if r.Continue.Clcontinue == "" {
+			return found, nil
+		}
+		cont = r.Continue.Clcontinue
+	}
+}
+
+// Subcategories returns the direct subcategories of a category.
+func (x *CategoryIndex) Subcategories(ctx context.Context, category string) ([]string, error) {
+	return categoryMembers(ctx, x.client, x.endpoint, category, "subcat")
+}
+
+// categoryMembers returns the members of a category of the cmtype, e.g. subcat or page.
+func categoryMembers(ctx context.Context, client *http.Client, endpoint url.URL, category, cmtype string) ([]string, error) {
+	type response struct {
+		Continue struct {
+			Cmcontinue string `json:"cmcontinue"`
+		} `json:"continue"`
+
+		Query struct {
+			Members []struct {
+				Title string `json:"title"`
+			} `json:"categorymembers"`
+		} `json:"query"`
+	}
+
+	var members []string
+	var cont string
+	for {
+		v := url.Values{}
+		v.Set("action", "query")
+		v.Set("list", "categorymembers")
+		v.Set("cmtitle", category)
+		v.Set("cmtype", cmtype)
+		v.Set("cmlimit", "max")
+		if cont != "" {
+			v.Set("cmcontinue", cont)
+		}
+
+		r := &response{}
+		if err := queryAPI(ctx, client, endpoint, v, r); err != nil {
+			return nil, err
+		}
+
+		for _, m := range r.Query.Members {
+			members = append(members, m.Title)
+		}
+
+		if r.Continue.Cmcontinue == "" {
+			return members, nil
+		}
+		cont = r.Continue.Cmcontinue
+	}
+}
+
+// Expand returns the set of the categories with their subcategories down to depth levels.
+func (x *CategoryIndex) Expand(ctx context.Context, categories []string, depth int) (map[string]bool, error) {
+	set := map[string]bool{}
+	level := make([]string, 0, len(categories))
+	for _, c := range categories {
+		c = CategoryTitle(c)
+		if !set[c] {
+			set[c] = true
+			level = append(level, c)
+		}
+	}
+
+	for d := 0; d < depth && len(level) > 0; d++ {
+		var next []string
+		for _, c := range level {
+			subcategories, err := x.Subcategories(ctx, c)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, s := range subcategories {
+				if !set[s] {
+					set[s] = true
+					next = append(next, s)
+				}
+			}
+		}
+		level = next
+	}
+	return set, nil
+}
+
+// CategoryFilter drops the links to the pages which are not in any of the categories or
+// their subcategories down to depth levels. The keep links are never dropped, e.g. the race destination.
+// The category tree is expanded on the first fetch.
+func CategoryFilter(index *CategoryIndex, categories []string, depth int, keep ...string) Middleware {
+	f := &categoryFilter{
+		index:      index,
+		categories: categories,
+		depth:      depth,
+		keep:       make(map[string]bool, len(keep)),
+	}
+	for _, k := range keep {
+		f.keep[k] = true
+	}
+
+	return func(next WikiCrawler) WikiCrawler {
+		return CrawlerFunc(func(ctx context.Context, link string) (*Page, error) {
+			page, err := next.Fetch(ctx, link)
+			if err != nil {
+				return nil, err
+			}
+			return f.filter(ctx, page)
+		})
+	}
+}
+
+type categoryFilter struct {
+	sync.Mutex
+
+	index      *CategoryIndex
+	categories []string
+	depth      int
+	keep       map[string]bool
+
+	allowed map[string]bool
+}
+
+// allowedCategories expands the category tree once. A failed expansion is repeated on the next call.
+func (f *categoryFilter) allowedCategories(ctx context.Context) (map[string]bool, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.allowed != nil {
+		return f.allowed, nil
+	}
+
+	allowed, err := f.index.Expand(ctx, f.categories, f.depth)
+	if err != nil {
+		return nil, err
+	}
+	f.allowed = allowed
+	return allowed, nil
+}
+
+func (f *categoryFilter) filter(ctx context.Context, page *Page) (*Page, error) {
+	allowed, err := f.allowedCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	titles := make([]string, 0, len(page.Links))
+	for l := range page.Links {
+		if !f.keep[l] {
+			titles = append(titles, l)
+		}
+	}
+
+	categories, err := f.index.Categories(ctx, titles)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := *page
+	filtered.Links = make(map[string]bool, len(page.Links))
+	for l := range page.Links {
+		if f.keep[l] || inCategories(categories[l], allowed) {
+			filtered.Links[l] = true
+		}
+	}
+
+	if page.Anchors != nil {
+		filtered.Anchors = make(map[string]Anchor, len(filtered.Links))
+		for l, a := range page.Anchors {
+			if filtered.Links[l] {
+				filtered.Anchors[l] = a
+			}
+		}
+	}
+	return &filtered, nil
+}
+
+func inCategories(categories []string, allowed map[string]bool) bool {
+	for _, c := range categories {
+		if allowed[c] {
+			return true
+		}
+	}
+	return false
+}
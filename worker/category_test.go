@@ -0,0 +1,118 @@
+package worker
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/darkonie/wikiracer/fakewiki"
+)
+
+func categoryGraph() fakewiki.CategoryGraph {
+	return fakewiki.CategoryGraph{
+		Graph: fakewiki.MapGraph{
+			"Isaac Newton":    {"Gravity", "Optics", "Lincolnshire", "Ukraine"},
+			"Gravity":         {},
+			"Optics":          {},
+			"Lincolnshire":    {},
+			"Ukraine":         {},
+			"Albert Einstein": {},
+		},
+		Parents: map[string][]string{
+			"Isaac Newton":                 {"Category:Physicists"},
+			"Gravity":                      {"Category:Physics"},
+			"Optics":                       {"Category:Optics"},
+			"Lincolnshire":                 {"Category:Counties of England"},
+			"Category:Optics":              {"Category:Physics"},
+			"Category:Physicists":          {"Category:Physics", "Category:Scientists"},
+			"Category:Counties of England": {"Category:England"},
+			"Category:Scientists":          {"Category:Stub categories"},
+		},
+		Hidden: map[string]bool{"Category:Stub categories": true},
+	}
+}
+
+func TestCategoryIndexExpand(t *testing.T) {
+	srv := fakewiki.NewServer(categoryGraph(), 1)
+	defer srv.Close()
+
+	index := NewCategoryIndex(srv.Client(), url.URL{Scheme: "https", Host: "en.wikipedia.org"}, nil)
+	set, err := index.Expand(context.Background(), []string{"Physics"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []string{"Category:Physics", "Category:Optics", "Category:Physicists"} {
+		if !set[c] {
+			t.Errorf("expect %s in %v", c, set)
+		}
+	}
+	if len(set) != 3 {
+		t.Fatalf("expect 3 categories. Got %v", set)
+	}
+}
+
+func TestCategoryFilter(t *testing.T) {
+	srv := fakewiki.NewServer(categoryGraph(), 0)
+	defer srv.Close()
+
+	index := NewCategoryIndex(srv.Client(), url.URL{Scheme: "https", Host: "en.wikipedia.org"}, nil)
+	for depth, expected := range map[int][]string{
+		0: {"Gravity", "Ukraine"},
+		1: {"Gravity", "Optics", "Ukraine"},
+	} {
+		c := Chain(NewHTMLWikiCrawler(srv.Client()), CategoryFilter(index, []string{"Category:Physics"}, depth, "Ukraine"))
+		page, err := c.Fetch(context.Background(), "Isaac_Newton")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(page.Links) != len(expected) || len(page.Anchors) != len(expected) {
+			t.Fatalf("depth %d: expect links %v. Got %v", depth, expected, page.Links)
+		}
+		for _, l := range expected {
+			if !page.Links[l] {
+				t.Fatalf("depth %d: expect links %v. Got %v", depth, expected, page.Links)
+			}
+		}
+	}
+}
+
+func TestCategoryWikiCrawler(t *testing.T) {
+	srv := fakewiki.NewServer(categoryGraph(), 0)
+	defer srv.Close()
+
+	page, err := NewCategoryWikiCrawler(srv.Client()).Fetch(context.Background(), "Category:Physics")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	anchors := map[string]Anchor{
+		"Category:Optics":     {Text: "Optics", Section: "Subcategories"},
+		"Category:Physicists": {Text: "Physicists", Section: "Subcategories"},
+	}
+	if len(page.Links) != len(anchors) {
+		t.Fatalf("expect links %v. Got %v", anchors, page.Links)
+	}
+	for l, a := range anchors {
+		if page.Anchors[l] != a {
+			t.Fatalf("expect anchor %+v for %s. Got %+v", a, l, page.Anchors[l])
+		}
+	}
+
+	page, err = NewCategoryWikiCrawler(srv.Client()).Fetch(context.Background(), "Physicists")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Links) != 2 || page.Anchors["Category:Scientists"].Section != "Categories" {
+		t.Fatalf("expect parent categories. Got %v", page.Anchors)
+	}
+
+	page, err = NewCategoryWikiCrawler(srv.Client()).Fetch(context.Background(), "Scientists")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Links["Category:Stub categories"] {
+		t.Fatalf("expect no hidden categories. Got %v", page.Links)
+	}
+}
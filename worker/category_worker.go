@@ -0,0 +1,117 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+func init() {
+	Register("category", Factory{
+		Description: "races through the category graph, the links are subcategories (list=categorymembers) and parent categories (prop=categories)",
+		Options: []OptionSpec{
+			hostOption,
+			{
+				Name:        "direction",
+				Type:        OptionString,
+				Default:     "both",
+				Description: "follow subcategories (down), parent categories (up) or both",
+			},
+		},
+		New: func(env Env, opts Options) WikiCrawler {
+			c := newCategoryWikiCrawler(env.Client)
+			c.endpoint = withHost(c.endpoint, opts)
+			switch opts.String("direction") {
+			case "down":
+				c.parents = false
+			case "up":
+				c.subcategories = false
+			}
+			return c
+		},
+		Normalize: func(_ Options, title string) string {
+			return CategoryTitle(title)
+		},
+		Resolve: resolveWikiTitle(nil),
+	})
+}
+
+// ErrAsOfUnsupported is returned by the crawlers which cannot read the pages as of a time.
+var ErrAsOfUnsupported = errors.New("as_of is not supported by the crawler")
+
+// NewCategoryWikiCrawler returns a crawler of the category graph. The pages are categories, e.g. Category:Physics,
+// and the links are their subcategories and parent categories.
+func NewCategoryWikiCrawler(client *http.Client) WikiCrawler {
+	return newCategoryWikiCrawler(client)
+}
+
+func newCategoryWikiCrawler(client *http.Client) *categoryWikiCrawler {
+	return &categoryWikiCrawler{
+		client: client,
+		endpoint: url.URL{
+			Scheme: "https",
+			Host:   "en.wikipedia.org",
+			Path:   "/w/api.php",
+		},
+		subcategories: true,
+		parents:       true,
+	}
+}
+
+// categoryWikiCrawler is using wikipedia api to walk the category graph.
+type categoryWikiCrawler struct {
+	client *http.Client
+
+	endpoint url.URL
+
+	subcategories, parents bool
+}
+
+// Fetch returns a category page with links to its subcategories and parent categories.
+// The anchors tell which of the sections of the category page has the link.
+func (c *categoryWikiCrawler) Fetch(ctx context.Context, link string) (*Page, error) {
+	if _, ok := AsOf(ctx); ok {
+		return nil, ErrAsOfUnsupported
+	}
+
+	title := CategoryTitle(link)
+	page := &Page{
+		Name:    link,
+		Links:   make(map[string]bool),
+		Anchors: make(map[string]Anchor),
+	}
+
+	add := func(categories []string, section string) {
+		for _, category := range categories {
+			if Namespace(category) != NamespaceCategory || page.Links[category] {
+				continue
+			}
+			page.Links[category] = true
+			page.Anchors[category] = Anchor{
+				Text:    strings.TrimPrefix(category, categoryPrefix),
+				Section: section,
+			}
+		}
+	}
+
+	if c.subcategories {
+		subcategories, err := categoryMembers(ctx, c.client, c.endpoint, title, "subcat")
+		if err != nil {
+			return nil, err
+		}
+		add(subcategories, "Subcategories")
+	}
+
+	if c.parents {
+		// the hidden maintenance categories, e.g. Category:Articles with short description, are no shortcuts.
+		parents, err := pageCategories(ctx, c.client, c.endpoint, []string{title}, false)
+		if err != nil {
+			return nil, err
+		}
+		add(parents[title], "Categories")
+	}
+
+	return page, nil
+}
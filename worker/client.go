@@ -0,0 +1,237 @@
+package worker
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultUserAgent identifies the crawler as required by the Wikimedia User-Agent policy
+// https://meta.wikimedia.org/wiki/User-Agent_policy.
+const DefaultUserAgent = "wikiracer/1.0 (https://github.com/darkonie/wikiracer)"
+
+// ClientProfile describes an http client used to talk to the upstream.
+// The durations are strings parsed with time.ParseDuration, so the profiles are easy
+// to write in a JSON file. Zero values and nil flags are taken from DefaultClientProfile,
+// so the flags are pointers to let a profile turn them off explicitly.
+type ClientProfile struct {
+	// UserAgent is sent with every request.
+	UserAgent string `json:"user_agent,omitempty"`
+
+	// Proxy is a proxy url. Empty means HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+	Proxy string `json:"proxy,omitempty"`
+
+	// CAFile is a PEM bundle of certificate authorities trusted in addition to the system ones.
+	CAFile string `json:"ca_file,omitempty"`
+
+	// InsecureSkipVerify disables the upstream certificate verification.
+	InsecureSkipVerify *bool `json:"insecure_skip_verify,omitempty"`
+
+	// Timeout limits a whole request including reading the body.
+	Timeout string `json:"timeout,omitempty"`
+
+	DialTimeout           string `json:"dial_timeout,omitempty"`
+	TLSHandshakeTimeout   string `json:"tls_handshake_timeout,omitempty"`
+	ResponseHeaderTimeout string `json:"response_header_timeout,omitempty"`
+	IdleConnTimeout       string `json:"idle_conn_timeout,omitempty"`
+
+	MaxIdleConns        int `json:"max_idle_conns,omitempty"`
+	MaxIdleConnsPerHost int `json:"max_idle_conns_per_host,omitempty"`
+	MaxConnsPerHost     int `json:"max_conns_per_host,omitempty"`
+
+	// DisableHTTP2 makes the client use HTTP/1.1 only.
+	DisableHTTP2 *bool `json:"disable_http2,omitempty"`
+}
+
+// DefaultClientProfile is used for the fields which are not set in a profile.
+// All workers of a job talk to the same host, so keep enough idle connections for them.
+var DefaultClientProfile = ClientProfile{
+	UserAgent:             DefaultUserAgent,
+	Timeout:               "60s",
+	DialTimeout:           "10s",
+	TLSHandshakeTimeout:   "10s",
+	ResponseHeaderTimeout: "30s",
+	IdleConnTimeout:       "90s",
+	MaxIdleConns:          100,
+	MaxIdleConnsPerHost:   100,
+}
+
+// WithDefaults returns a copy of p with the empty fields taken from def.
+func (p ClientProfile) WithDefaults(def ClientProfile) ClientProfile {
+	str := func(v *string, d string) {
+		if *v == "" {
+			*v = d
+		}
+	}
+	num := func(v *int, d int) {
+		if *v == 0 {
+			*v = d
+		}
+	}
+	flag := func(v **bool, d *bool) {
+		if *v == nil {
+			*v = d
+		}
+	}
+
+	str(&p.UserAgent, def.UserAgent)
+	str(&p.Proxy, def.Proxy)
+	str(&p.CAFile, def.CAFile)
+	str(&p.Timeout, def.Timeout)
+	str(&p.DialTimeout, def.DialTimeout)
+	str(&p.TLSHandshakeTimeout, def.TLSHandshakeTimeout)
+	str(&p.ResponseHeaderTimeout, def.ResponseHeaderTimeout)
+	str(&p.IdleConnTimeout, def.IdleConnTimeout)
+	num(&p.MaxIdleConns, def.MaxIdleConns)
+	num(&p.MaxIdleConnsPerHost, def.MaxIdleConnsPerHost)
+	num(&p.MaxConnsPerHost, def.MaxConnsPerHost)
+	flag(&p.InsecureSkipVerify, def.InsecureSkipVerify)
+	flag(&p.DisableHTTP2, def.DisableHTTP2)
+	return p
+}
+
+// isSet returns true if the profile flag is set and true.
+func isSet(flag *bool) bool {
+	return flag != nil && *flag
+}
+
+// NewHTTPTransport builds a round tripper described by the profile. It sets the User-Agent
+// header on the requests which do not have one.
+func NewHTTPTransport(p ClientProfile) (http.RoundTripper, error) {
+	disableHTTP2 := isSet(p.DisableHTTP2)
+	insecure := isSet(p.InsecureSkipVerify)
+
+	var d durations
+	dialTimeout := d.parse("dial_timeout", p.DialTimeout)
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: time.Second * 30,
+		}).DialContext,
+		TLSHandshakeTimeout:   d.parse("tls_handshake_timeout", p.TLSHandshakeTimeout),
+		ResponseHeaderTimeout: d.parse("response_header_timeout", p.ResponseHeaderTimeout),
+		IdleConnTimeout:       d.parse("idle_conn_timeout", p.IdleConnTimeout),
+		MaxIdleConns:          p.MaxIdleConns,
+		MaxIdleConnsPerHost:   p.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       p.MaxConnsPerHost,
+		ForceAttemptHTTP2:     !disableHTTP2,
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	if disableHTTP2 {
+		// a non nil empty map disables HTTP/2.
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+
+	if p.Proxy != "" {
+		proxy, err := url.Parse(p.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url %q: %s", p.Proxy, err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if p.CAFile != "" || insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: insecure}
+	}
+
+	if p.CAFile != "" {
+		pool, err := certPool(p.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
+	userAgent := p.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+
+	return &userAgentTransport{
+		next:      transport,
+		userAgent: userAgent,
+	}, nil
+}
+
+// NewHTTPClient returns a client with the overall timeout of the profile which sends the requests
+// with transport, e.g. the one from NewHTTPTransport wrapped with limits.
+func NewHTTPClient(p ClientProfile, transport http.RoundTripper) (*http.Client, error) {
+	var d durations
+	timeout := d.parse("timeout", p.Timeout)
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}, nil
+}
+
+// certPool returns the system cert pool with the certificates from the PEM file added.
+func certPool(file string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read CA file: %s", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA file %s", file)
+	}
+	return pool, nil
+}
+
+// durations parses the profile durations and keeps the first error.
+type durations struct {
+	err error
+}
+
+func (d *durations) parse(name, v string) time.Duration {
+	if v == "" || d.err != nil {
+		return 0
+	}
+
+	t, err := time.ParseDuration(v)
+	if err != nil {
+		d.err = fmt.Errorf("invalid %s %q: %s", name, v, err)
+		return 0
+	}
+	return t
+}
+
+// userAgentTransport sets the User-Agent header.
+type userAgentTransport struct {
+	next      http.RoundTripper
+	userAgent string
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") != "" {
+		return t.next.RoundTrip(req)
+	}
+
+	// a round tripper must not modify the request.
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	r.Header.Set("User-Agent", t.userAgent)
+	return t.next.RoundTrip(r)
+}
@@ -0,0 +1,99 @@
+package worker
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHTTPClientProfile(t *testing.T) {
+	var agent string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agent = r.UserAgent()
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "wikiracer-ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, cert, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := ClientProfile{CAFile: caFile}.WithDefaults(DefaultClientProfile)
+	transport, err := NewHTTPTransport(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewHTTPClient(p, transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if agent != DefaultUserAgent {
+		t.Fatalf("expect user agent %q. Got %q", DefaultUserAgent, agent)
+	}
+}
+
+func TestClientProfileFlags(t *testing.T) {
+	on, off := true, false
+	def := ClientProfile{InsecureSkipVerify: &on, DisableHTTP2: &on}
+
+	p := ClientProfile{DisableHTTP2: &off}.WithDefaults(def)
+	if !isSet(p.InsecureSkipVerify) || isSet(p.DisableHTTP2) {
+		t.Fatalf("expect the profile to turn off http2 only. Got %v, %v", *p.InsecureSkipVerify, *p.DisableHTTP2)
+	}
+}
+
+func TestHTTPClientProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	transport, err := NewHTTPTransport(ClientProfile{Proxy: proxy.URL, UserAgent: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := (&http.Client{Transport: transport}).Get("http://en.wikipedia.org/wiki/Ukraine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if proxied != "http://en.wikipedia.org/wiki/Ukraine" {
+		t.Fatalf("expect the request to go through the proxy. Got %q", proxied)
+	}
+}
+
+func TestHTTPClientProfileErrors(t *testing.T) {
+	for _, p := range []ClientProfile{
+		{Timeout: "soon"},
+		{Proxy: "://"},
+		{CAFile: "/does/not/exist.pem"},
+	} {
+		if _, err := NewHTTPTransport(p); err == nil {
+			if _, err := NewHTTPClient(p, nil); err == nil {
+				t.Errorf("expect an error for %+v", p)
+			}
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/darkonie/wikiracer/fakewiki"
+)
+
+func testGraph() fakewiki.MapGraph {
+	g := fakewiki.MapGraph{
+		"Mike Tyson": {"Boxing", "Talk:Mike Tyson", "Mercury (planet)", "Kraków", "Star Wars: Episode IV"},
+	}
+	for i := 0; i < 1200; i++ {
+		g["Boxing"] = append(g["Boxing"], fmt.Sprintf("Boxer %d", i))
+	}
+	return g
+}
+
+func TestAPIWikiCrawlerPagination(t *testing.T) {
+	srv := fakewiki.NewServer(testGraph(), 100)
+	defer srv.Close()
+
+	page, err := NewAPIWikiCrawler(srv.Client()).Fetch(context.Background(), "Boxing")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(page.Links) != 1200 {
+		t.Fatalf("expect 1200 links. Got %d", len(page.Links))
+	}
+}
+
+func TestHTMLWikiCrawler(t *testing.T) {
+	srv := fakewiki.NewServer(testGraph(), 0)
+	defer srv.Close()
+
+	page, err := NewHTMLWikiCrawler(srv.Client()).Fetch(context.Background(), "Mike_Tyson")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"Boxing", "Mercury_(planet)", "Kraków", "Star_Wars:_Episode_IV"}
+	if len(page.Links) != len(expected) {
+		t.Fatalf("expect links %v. Got %v", expected, page.Links)
+	}
+	for _, l := range expected {
+		if !page.Links[l] {
+			t.Fatalf("expect link %s. Got %v", l, page.Links)
+		}
+	}
+
+	anchors := map[string]Anchor{
+		"Boxing": {Text: "Boxing", Context: "It is related to Boxing."},
+		"Kraków": {Text: "Kraków", Section: "Related pages", Context: "See Kraków for more."},
+	}
+	for l, a := range anchors {
+		if page.Anchors[l] != a {
+			t.Fatalf("expect anchor %+v for %s. Got %+v", a, l, page.Anchors[l])
+		}
+	}
+
+	if _, err := NewHTMLWikiCrawler(srv.Client()).Fetch(context.Background(), "Ukraine"); err == nil {
+		t.Fatal("expect error for missing page")
+	}
+}
+
+func TestDisambiguation(t *testing.T) {
+	srv := fakewiki.NewServer(fakewiki.MapGraph{
+		"Mercury (disambiguation)": {"Mercury (planet)", "Mercury (element)"},
+		"Mercury (planet)":         {"Sun"},
+	}, 1)
+	defer srv.Close()
+
+	crawlers := map[string]WikiCrawler{
+		"api":     NewAPIWikiCrawler(srv.Client()),
+		"html":    NewHTMLWikiCrawler(srv.Client()),
+		"parsoid": NewParsoidWikiCrawler(srv.Client()),
+	}
+
+	for method, c := range crawlers {
+		page, err := c.Fetch(context.Background(), "Mercury (disambiguation)")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !page.Disambiguation {
+			t.Fatalf("%s: expect disambiguation page", method)
+		}
+
+		page, err = c.Fetch(context.Background(), "Mercury (planet)")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Disambiguation {
+			t.Fatalf("%s: expect regular page", method)
+		}
+	}
+}
+
+func TestAsOf(t *testing.T) {
+	srv := fakewiki.NewServer(testGraph(), 0)
+	defer srv.Close()
+
+	crawlers := map[string]WikiCrawler{
+		"api":     NewAPIWikiCrawler(srv.Client()),
+		"html":    NewHTMLWikiCrawler(srv.Client()),
+		"parsoid": NewParsoidWikiCrawler(srv.Client()),
+	}
+
+	for method, c := range crawlers {
+		ctx := WithAsOf(context.Background(), fakewiki.Created.AddDate(1, 0, 0))
+		page, err := c.Fetch(ctx, "Mike Tyson")
+		if err != nil {
+			t.Fatalf("%s: %s", method, err)
+		}
+		if len(page.Links) != 4 {
+			t.Fatalf("%s: expect 4 links. Got %v", method, page.Links)
+		}
+
+		ctx = WithAsOf(context.Background(), fakewiki.Created.AddDate(-1, 0, 0))
+		if _, err := c.Fetch(ctx, "Mike Tyson"); err != ErrNoRevision {
+			t.Fatalf("%s: expect no revision. Got %v", method, err)
+		}
+	}
+}
+
+func TestParsoidWikiCrawler(t *testing.T) {
+	srv := fakewiki.NewServer(testGraph(), 0)
+	defer srv.Close()
+
+	page, err := NewParsoidWikiCrawler(srv.Client()).Fetch(context.Background(), "Mike Tyson")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	anchors := map[string]Anchor{
+		"Boxing":                {Text: "Boxing", Context: "It is related to Boxing."},
+		"Kraków":                {Text: "Kraków", Section: "Related pages", Context: "See Kraków for more."},
+		"Mercury (planet)":      {Text: "Mercury (planet)", Section: "Related pages", Context: "See Mercury (planet) for more."},
+		"Star Wars: Episode IV": {Text: "Star Wars: Episode IV", Section: "Related pages", Context: "See Star Wars: Episode IV for more."},
+	}
+	if len(page.Links) != len(anchors) {
+		t.Fatalf("expect links %v. Got %v", anchors, page.Links)
+	}
+	for l, a := range anchors {
+		if page.Anchors[l] != a {
+			t.Fatalf("expect anchor %+v for %s. Got %+v", a, l, page.Anchors[l])
+		}
+	}
+}
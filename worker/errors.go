@@ -0,0 +1,104 @@
+package worker
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+)
+
+// fetch error kinds used to account errors.
+const (
+	ErrKindTimeout         = "timeout"
+	ErrKindServerError     = "server_error"
+	ErrKindTooManyRequests = "too_many_requests"
+	ErrKindClientError     = "client_error"
+	ErrKindConnReset       = "connection_reset"
+	ErrKindCircuitOpen     = "circuit_open"
+	ErrKindRobots          = "robots_unavailable"
+	ErrKindOther           = "other"
+)
+
+// StatusError is returned when upstream responds with unexpected status code.
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("bad response: %d", e.Code)
+}
+
+// ErrorKind classifies a fetch error.
+func ErrorKind(err error) string {
+	if err == ErrCircuitOpen {
+		return ErrKindCircuitOpen
+	}
+	if cause(err) == ErrRobotsUnavailable {
+		return ErrKindRobots
+	}
+
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return ErrKindTimeout
+	}
+
+	switch e := cause(err).(type) {
+	case *StatusError:
+		switch {
+		case e.Code == http.StatusTooManyRequests:
+			return ErrKindTooManyRequests
+		case e.Code >= 500:
+			return ErrKindServerError
+		default:
+			return ErrKindClientError
+		}
+	case syscall.Errno:
+		if e == syscall.ECONNRESET || e == syscall.ECONNABORTED || e == syscall.EPIPE {
+			return ErrKindConnReset
+		}
+	}
+
+	if c := cause(err); c == io.EOF || c == io.ErrUnexpectedEOF {
+		return ErrKindConnReset
+	}
+
+	return ErrKindOther
+}
+
+// IsTransient returns true if the fetch which failed with err is worth retrying.
+func IsTransient(err error) bool {
+	switch ErrorKind(err) {
+	case ErrKindTimeout, ErrKindServerError, ErrKindTooManyRequests, ErrKindConnReset:
+		return true
+	}
+	return false
+}
+
+// IsUnavailable returns true if the page was not fetched because the upstream does not take
+// the fetches for a while, e.g. the circuit breaker is open. Such fetches are worth repeating
+// until the upstream is back.
+func IsUnavailable(err error) bool {
+	switch ErrorKind(err) {
+	case ErrKindCircuitOpen, ErrKindRobots:
+		return true
+	}
+	return false
+}
+
+// cause unwraps the errors returned by http client.
+func cause(err error) error {
+	for {
+		switch e := err.(type) {
+		case *url.Error:
+			err = e.Err
+		case *net.OpError:
+			err = e.Err
+		case *os.SyscallError:
+			err = e.Err
+		default:
+			return err
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package worker
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// maxContextLen limits the length of the sentence stored in Anchor.Context.
+const maxContextLen = 300
+
+// extractLinks tokenizes an HTML document and returns the links with their anchors.
+// resolve converts an anchor tag to a page name and returns false if the link should be skipped.
+// inspect is called for every start tag, it can be nil.
+// Only the first anchor of every link is kept.
+func extractLinks(r io.Reader, resolve func(html.Token) (string, bool), inspect func(html.Token)) (map[string]Anchor, error) {
+	e := &extractor{
+		resolve: resolve,
+		inspect: inspect,
+		anchors: make(map[string]Anchor),
+	}
+
+	z := html.NewTokenizer(r)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			e.flush()
+			if err := z.Err(); err != io.EOF {
+				return nil, err
+			}
+			return e.anchors, nil
+		case html.StartTagToken, html.SelfClosingTagToken:
+			e.start(z.Token())
+		case html.EndTagToken:
+			e.end(z.Token())
+		case html.TextToken:
+			e.text(string(z.Text()))
+		}
+	}
+}
+
+// pendingAnchor is a link waiting for the end of its block to get the context.
+type pendingAnchor struct {
+	link string
+	text bytes.Buffer
+
+	// block is the number of the block the anchor starts in, from and to are the offsets
+	// of its text in the block.
+	block    int
+	from, to int
+}
+
+type extractor struct {
+	resolve func(html.Token) (string, bool)
+	inspect func(html.Token)
+
+	anchors map[string]Anchor
+	section string
+
+	// heading is not nil inside h2-h6 tags.
+	heading *bytes.Buffer
+	// editDepth counts the nested spans of the section edit link.
+	editDepth int
+	// skipDepth counts the nested script and style tags.
+	skipDepth int
+
+	block   bytes.Buffer
+	blocks  int
+	pending []*pendingAnchor
+	current *pendingAnchor
+}
+
+func isBlock(tag string) bool {
+	switch tag {
+	case "p", "li", "dd", "dt", "td", "th", "caption", "figcaption", "div", "table", "ul", "ol", "blockquote":
+		return true
+	}
+	return false
+}
+
+func isHeading(tag string) bool {
+	switch tag {
+	case "h2", "h3", "h4", "h5", "h6":
+		return true
+	}
+	return false
+}
+
+// attr returns the value of the tag attribute.
+func attr(t html.Token, key string) (string, bool) {
+	for _, a := range t.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// hasValue returns true if the space separated list attribute (e.g. class or rel) contains value.
+func hasValue(t html.Token, key, value string) bool {
+	v, _ := attr(t, key)
+	for _, f := range strings.Fields(v) {
+		if f == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *extractor) start(t html.Token) {
+	if e.inspect != nil {
+		e.inspect(t)
+	}
+
+	switch {
+	case t.Data == "script" || t.Data == "style":
+		if t.Type == html.StartTagToken {
+			e.skipDepth++
+		}
+	case isHeading(t.Data):
+		e.flush()
+		e.heading = &bytes.Buffer{}
+		e.editDepth = 0
+	case t.Data == "span" && e.heading != nil && t.Type == html.StartTagToken:
+		if e.editDepth > 0 || hasValue(t, "class", "mw-editsection") {
+			e.editDepth++
+		}
+	case isBlock(t.Data):
+		e.flush()
+	case t.Data == "a":
+		if link, ok := e.resolve(t); ok {
+			e.current = &pendingAnchor{link: link, block: e.blocks, from: e.block.Len()}
+		}
+	}
+}
+
+func (e *extractor) end(t html.Token) {
+	switch {
+	case t.Data == "script" || t.Data == "style":
+		if e.skipDepth > 0 {
+			e.skipDepth--
+		}
+	case t.Data == "span" && e.editDepth > 0:
+		e.editDepth--
+	case isHeading(t.Data) && e.heading != nil:
+		e.section = strings.Join(strings.Fields(strings.TrimSuffix(strings.TrimSpace(e.heading.String()), "[edit]")), " ")
+		e.heading = nil
+	case isBlock(t.Data):
+		e.flush()
+	case t.Data == "a" && e.current != nil:
+		a := e.current
+		e.current = nil
+		if _, ok := e.anchors[a.link]; ok {
+			return
+		}
+
+		e.anchors[a.link] = Anchor{
+			Text:    strings.Join(strings.Fields(a.text.String()), " "),
+			Section: e.section,
+		}
+
+		// the anchors in headings or spanning several blocks get no context.
+		if e.heading == nil && a.block == e.blocks {
+			a.to = e.block.Len()
+			e.pending = append(e.pending, a)
+		}
+	}
+}
+
+func (e *extractor) text(text string) {
+	if e.skipDepth > 0 {
+		return
+	}
+
+	if e.current != nil {
+		e.current.text.WriteString(text)
+	}
+
+	if e.heading != nil {
+		if e.editDepth == 0 {
+			e.heading.WriteString(text)
+		}
+		return
+	}
+	e.block.WriteString(text)
+}
+
+// flush sets the context of the anchors found in the current block and starts a new block.
+func (e *extractor) flush() {
+	text := e.block.String()
+	for _, p := range e.pending {
+		a := e.anchors[p.link]
+		a.Context = sentence(text, p.from, p.to)
+		e.anchors[p.link] = a
+	}
+
+	e.pending = e.pending[:0]
+	e.block.Reset()
+	e.blocks++
+}
+
+// sentence returns the sentence of text which contains text[from:to].
+func sentence(text string, from, to int) string {
+	start := 0
+	for _, sep := range []string{". ", "! ", "? ", "\n"} {
+		if i := strings.LastIndex(text[:from], sep); i > -1 && i+len(sep) > start {
+			start = i + len(sep)
+		}
+	}
+
+	end := len(text)
+	for _, sep := range []string{". ", "! ", "? ", "\n"} {
+		if i := strings.Index(text[to:], sep); i > -1 && to+i+1 < end {
+			end = to + i + 1
+		}
+	}
+
+	s := strings.Join(strings.Fields(text[start:end]), " ")
+	if len(s) > maxContextLen {
+		n := maxContextLen
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+		s = s[:n] + "..."
+	}
+	return s
+}
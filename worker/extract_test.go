@@ -0,0 +1,38 @@
+package worker
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestExtractLinksNested(t *testing.T) {
+	resolve := func(t html.Token) (string, bool) {
+		return attr(t, "href")
+	}
+
+	docs := map[string]map[string]Anchor{
+		`<h2><a href="A">Heading link</a></h2><p>short</p>`: {
+			"A": {Text: "Heading link"},
+		},
+		`<p>A paragraph with a card. <a href="B"><div>card</div></a></p>`: {
+			"B": {Text: "card"},
+		},
+		`<p>First one. Then <a href="C">a link</a> here. Last.</p>`: {
+			"C": {Text: "a link", Context: "Then a link here."},
+		},
+	}
+
+	for doc, expected := range docs {
+		anchors, err := extractLinks(strings.NewReader(doc), resolve, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for link, a := range expected {
+			if anchors[link] != a {
+				t.Fatalf("%s: expect anchor %+v. Got %+v", doc, a, anchors[link])
+			}
+		}
+	}
+}
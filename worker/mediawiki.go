@@ -0,0 +1,126 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// apiBatch is the number of titles or ids MediaWiki API accepts in one query.
+const apiBatch = 50
+
+// APIError is an error returned by MediaWiki API.
+type APIError struct {
+	Code string `json:"code"`
+	Info string `json:"info"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("api error %s: %s", e.Code, e.Info)
+}
+
+// queryAPI sends a GET request with parameters v to MediaWiki API endpoint and decodes the json response into out.
+func queryAPI(ctx context.Context, client *http.Client, endpoint url.URL, v url.Values, out interface{}) error {
+	v.Set("format", "json")
+	endpoint.RawQuery = v.Encode()
+	logrus.Debugf("GET %s", endpoint.String())
+
+	req, err := http.NewRequest("GET", endpoint.String(), nil)
+	if err != nil {
+		return fmt.Errorf("unable to make a new request: %s", err)
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{Code: resp.StatusCode}
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("unable to read response: %s", err)
+	}
+
+	apiErr := &struct {
+		Error *APIError `json:"error"`
+	}{}
+	if err := json.Unmarshal(body, apiErr); err != nil {
+		return fmt.Errorf("unable to unmarshal response: %s", err)
+	}
+	if apiErr.Error != nil {
+		return apiErr.Error
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("unable to unmarshal response: %s", err)
+	}
+	return nil
+}
+
+// apiEndpoint returns MediaWiki API endpoint on the host of u.
+func apiEndpoint(u url.URL) url.URL {
+	return url.URL{
+		Scheme: u.Scheme,
+		Host:   u.Host,
+		Path:   "/w/api.php",
+	}
+}
+
+type asOfKey struct{}
+
+// WithAsOf returns a context which makes the crawlers read the pages as they were at the time t.
+func WithAsOf(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, asOfKey{}, t)
+}
+
+// AsOf returns the time set with WithAsOf and false if the live pages should be read.
+func AsOf(ctx context.Context) (time.Time, bool) {
+	t, ok := ctx.Value(asOfKey{}).(time.Time)
+	return t, ok
+}
+
+// ErrNoRevision is returned when a page did not exist at the requested time.
+var ErrNoRevision = fmt.Errorf("page has no revision at the requested time")
+
+// resolveRevision returns the id of the page revision which was current at the time t.
+func resolveRevision(ctx context.Context, client *http.Client, endpoint url.URL, title string, t time.Time) (int64, error) {
+	var r struct {
+		Query struct {
+			Pages map[string]struct {
+				Missing   *string `json:"missing"`
+				Revisions []struct {
+					RevID int64 `json:"revid"`
+				} `json:"revisions"`
+			} `json:"pages"`
+		} `json:"query"`
+	}
+
+	v := url.Values{}
+	v.Set("action", "query")
+	v.Set("prop", "revisions")
+	v.Set("titles", title)
+	v.Set("rvlimit", "1")
+	v.Set("rvdir", "older")
+	v.Set("rvprop", "ids|timestamp")
+	v.Set("rvstart", t.UTC().Format(time.RFC3339))
+	if err := queryAPI(ctx, client, endpoint, v, &r); err != nil {
+		return 0, err
+	}
+
+	for _, p := range r.Query.Pages {
+		if p.Missing == nil && len(p.Revisions) > 0 {
+			return p.Revisions[0].RevID, nil
+		}
+	}
+	return 0, ErrNoRevision
+}
@@ -0,0 +1,322 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/darkonie/wikiracer/primitives"
+	"github.com/sirupsen/logrus"
+)
+
+// Middleware decorates a WikiCrawler with a cross-cutting concern.
+type Middleware func(WikiCrawler) WikiCrawler
+
+// CrawlerFunc is an adapter to use ordinary functions as a WikiCrawler.
+type CrawlerFunc func(context.Context, string) (*Page, error)
+
+// Fetch calls f(ctx, link).
+func (f CrawlerFunc) Fetch(ctx context.Context, link string) (*Page, error) {
+	return f(ctx, link)
+}
+
+// Chain wraps the crawler c with middlewares. The first middleware is the outermost one.
+func Chain(c WikiCrawler, middlewares ...Middleware) WikiCrawler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		c = middlewares[i](c)
+	}
+	return c
+}
+
+// Logging logs every fetch with its duration.
+func Logging(name string) Middleware {
+	return func(next WikiCrawler) WikiCrawler {
+		return CrawlerFunc(func(ctx context.Context, link string) (*Page, error) {
+			start := time.Now()
+			page, err := next.Fetch(ctx, link)
+			if err != nil {
+				logrus.Debugf("%s: fetch %s failed after %s: %s", name, link, time.Since(start), err)
+				return nil, err
+			}
+
+			logrus.Debugf("%s: fetched %s with %d links in %s", name, link, len(page.Links), time.Since(start))
+			return page, nil
+		})
+	}
+}
+
+// FetchMetrics collects fetch counters. It is safe to share between crawlers.
+type FetchMetrics struct {
+	fetches, errors, skipped, links, latency uint64
+}
+
+// FetchStats is a snapshot of FetchMetrics.
+type FetchStats struct {
+	Fetches        uint64 `json:"fetches"`
+	Errors         uint64 `json:"errors"`
+	Skipped        uint64 `json:"skipped"`
+	Links          uint64 `json:"links"`
+	AverageLatency string `json:"average_latency"`
+
+	// Deduplicated is the number of fetches which shared the result of a concurrent fetch, see Dedup.
+	Deduplicated uint64 `json:"deduplicated"`
+}
+
+// Stats returns a snapshot of the metrics.
+func (m *FetchMetrics) Stats() FetchStats {
+	s := FetchStats{
+		Fetches: atomic.LoadUint64(&m.fetches),
+		Errors:  atomic.LoadUint64(&m.errors),
+		Skipped: atomic.LoadUint64(&m.skipped),
+		Links:   atomic.LoadUint64(&m.links),
+	}
+
+	var avg time.Duration
+	if s.Fetches > 0 {
+		avg = time.Duration(atomic.LoadUint64(&m.latency) / s.Fetches)
+	}
+	s.AverageLatency = avg.String()
+	return s
+}
+
+// Metrics accounts every fetch in m. The pages disallowed by robots.txt are skipped, not errors.
+func Metrics(m *FetchMetrics) Middleware {
+	return func(next WikiCrawler) WikiCrawler {
+		return CrawlerFunc(func(ctx context.Context, link string) (*Page, error) {
+			start := time.Now()
+			page, err := next.Fetch(ctx, link)
+
+			atomic.AddUint64(&m.fetches, 1)
+			atomic.AddUint64(&m.latency, uint64(time.Since(start)))
+			switch {
+			case IsDisallowed(err):
+				atomic.AddUint64(&m.skipped, 1)
+				return nil, err
+			case err != nil:
+				atomic.AddUint64(&m.errors, 1)
+				return nil, err
+			}
+
+			atomic.AddUint64(&m.links, uint64(len(page.Links)))
+			return page, nil
+		})
+	}
+}
+
+// Timeout limits the time of a single fetch. A timeout <= 0 disables it.
+// The time the crawler waits for the Crawl-delay of robots.txt is not counted.
+func Timeout(timeout time.Duration) Middleware {
+	return func(next WikiCrawler) WikiCrawler {
+		if timeout <= 0 {
+			return next
+		}
+
+		return CrawlerFunc(func(ctx context.Context, link string) (*Page, error) {
+			ctx, cancel := withTimeout(ctx, timeout)
+			defer cancel()
+			return next.Fetch(ctx, link)
+		})
+	}
+}
+
+// timeoutContext is done with context.DeadlineExceeded after the timeout, the clock can be
+// paused with pauseTimeout.
+type timeoutContext struct {
+	context.Context
+
+	mu        sync.Mutex
+	done      chan struct{}
+	err       error
+	timer     *time.Timer
+	remaining time.Duration
+	started   time.Time
+}
+
+type timeoutKey struct{}
+
+func withTimeout(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	c := &timeoutContext{
+		Context:   parent,
+		done:      make(chan struct{}),
+		remaining: timeout,
+		started:   time.Now(),
+	}
+	// the timer may fire before it is assigned.
+	c.mu.Lock()
+	c.timer = time.AfterFunc(timeout, func() {
+		c.cancel(context.DeadlineExceeded)
+	})
+	c.mu.Unlock()
+	stop := context.AfterFunc(parent, func() {
+		c.cancel(parent.Err())
+	})
+
+	return c, func() {
+		stop()
+		c.cancel(context.Canceled)
+	}
+}
+
+// Done implements context.Context interface.
+func (c *timeoutContext) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err implements context.Context interface.
+func (c *timeoutContext) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Value implements context.Context interface.
+func (c *timeoutContext) Value(key interface{}) interface{} {
+	if key == (timeoutKey{}) {
+		return c
+	}
+	return c.Context.Value(key)
+}
+
+func (c *timeoutContext) cancel(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err == nil {
+		c.err = err
+		c.timer.Stop()
+		close(c.done)
+	}
+}
+
+// pauseTimeout stops the clock of the fetch Timeout until resume is called.
+func pauseTimeout(ctx context.Context) (resume func()) {
+	c, ok := ctx.Value(timeoutKey{}).(*timeoutContext)
+	if !ok {
+		return func() {}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil || !c.timer.Stop() {
+		return func() {}
+	}
+	c.remaining -= time.Since(c.started)
+
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.err == nil {
+			c.started = time.Now()
+			c.timer.Reset(c.remaining)
+		}
+	}
+}
+
+// ErrCircuitOpen is returned while the circuit breaker does not let the fetches through.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// NewBreaker returns a circuit breaker which opens after threshold consecutive transient
+// errors and lets the fetches through again after cooldown.
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// Breaker is a circuit breaker shared by the crawlers talking to the same upstream.
+type Breaker struct {
+	sync.Mutex
+
+	threshold int
+	cooldown  time.Duration
+
+	failures  int
+	openUntil time.Time
+}
+
+func (b *Breaker) allow() bool {
+	b.Lock()
+	defer b.Unlock()
+	return !time.Now().Before(b.openUntil)
+}
+
+func (b *Breaker) record(err error) {
+	b.Lock()
+	defer b.Unlock()
+
+	if err == nil || !IsTransient(err) {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.threshold > 0 && b.failures >= b.threshold {
+		logrus.Warnf("circuit breaker is open for %s after %d errors", b.cooldown, b.failures)
+		b.openUntil = time.Now().Add(b.cooldown)
+		b.failures = 0
+	}
+}
+
+// CircuitBreaker fails fast with ErrCircuitOpen while b is open.
+func CircuitBreaker(b *Breaker) Middleware {
+	return func(next WikiCrawler) WikiCrawler {
+		return CrawlerFunc(func(ctx context.Context, link string) (*Page, error) {
+			if !b.allow() {
+				return nil, ErrCircuitOpen
+			}
+
+			page, err := next.Fetch(ctx, link)
+			if ctx.Err() == nil {
+				b.record(err)
+			}
+			return page, err
+		})
+	}
+}
+
+// Cache looks up the pages in cache before fetching them. The prefix separates the pages
+// fetched by different crawl methods. A nil cache disables it.
+func Cache(cache *LinkCache, prefix string) Middleware {
+	return func(next WikiCrawler) WikiCrawler {
+		if cache == nil {
+			return next
+		}
+		return NewCachingCrawler(next, cache, prefix)
+	}
+}
+
+// Dedup shares a single fetch of a page between the concurrent fetches of it, by any job.
+// The prefix separates the pages fetched by different crawl methods and client profiles.
+func Dedup(group *primitives.Group, prefix string) Middleware {
+	return func(next WikiCrawler) WikiCrawler {
+		return CrawlerFunc(func(ctx context.Context, link string) (*Page, error) {
+			key := prefix + ":" + link
+			if t, ok := AsOf(ctx); ok {
+				key = prefix + ":" + t.UTC().Format(time.RFC3339) + ":" + link
+			}
+
+			v, err, _ := group.Do(ctx, key, func(ctx context.Context) (interface{}, error) {
+				return next.Fetch(ctx, link)
+			})
+			if err != nil {
+				return nil, err
+			}
+			return v.(*Page), nil
+		})
+	}
+}
+
+// RateLimit waits for a token from bucket before every fetch.
+func RateLimit(bucket *primitives.TokenBucket) Middleware {
+	return func(next WikiCrawler) WikiCrawler {
+		return CrawlerFunc(func(ctx context.Context, link string) (*Page, error) {
+			if err := bucket.Wait(ctx); err != nil {
+				return nil, err
+			}
+			return next.Fetch(ctx, link)
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/darkonie/wikiracer/primitives"
+)
+
+func TestChain(t *testing.T) {
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next WikiCrawler) WikiCrawler {
+			return CrawlerFunc(func(ctx context.Context, link string) (*Page, error) {
+				order = append(order, name)
+				return next.Fetch(ctx, link)
+			})
+		}
+	}
+
+	failing := CrawlerFunc(func(ctx context.Context, link string) (*Page, error) {
+		return nil, &StatusError{Code: 503}
+	})
+
+	metrics := &FetchMetrics{}
+	c := Chain(failing, trace("first"), trace("second"), Metrics(metrics), CircuitBreaker(NewBreaker(2, time.Minute)))
+	for i := 0; i < 3; i++ {
+		c.Fetch(context.Background(), "Mike Tyson")
+	}
+
+	if order[0] != "first" || order[1] != "second" {
+		t.Fatalf("expect first middleware to be the outermost. Got %v", order)
+	}
+
+	if _, err := c.Fetch(context.Background(), "Mike Tyson"); err != ErrCircuitOpen {
+		t.Fatalf("expect open circuit. Got %v", err)
+	}
+
+	if stats := metrics.Stats(); stats.Fetches != 4 || stats.Errors != 4 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestDedup(t *testing.T) {
+	var fetches int32
+	release := make(chan struct{})
+	slow := CrawlerFunc(func(ctx context.Context, link string) (*Page, error) {
+		atomic.AddInt32(&fetches, 1)
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return &Page{Name: link, Links: map[string]bool{"Ukraine": true}}, nil
+	})
+
+	group := primitives.NewGroup()
+	c := Chain(slow, Dedup(group, "api"))
+
+	// the first caller leaves early, the others still get the page.
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, err := c.Fetch(ctx, "Mike Tyson")
+		first <- err
+	}()
+	for atomic.LoadInt32(&fetches) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	var wg sync.WaitGroup
+	pages := make(chan *Page, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			page, err := c.Fetch(context.Background(), "Mike Tyson")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			pages <- page
+		}()
+	}
+
+	for _, shared := group.Stats(); shared < 10; _, shared = group.Stats() {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Fatalf("expect the first caller cancelled. Got %v", err)
+	}
+	close(release)
+	wg.Wait()
+	close(pages)
+
+	n := 0
+	for page := range pages {
+		if !page.Links["Ukraine"] {
+			t.Fatalf("unexpected page %+v", page)
+		}
+		n++
+	}
+	if n != 10 || atomic.LoadInt32(&fetches) != 1 {
+		t.Fatalf("expect 10 pages from a single fetch. Got %d pages, %d fetches", n, fetches)
+	}
+
+	if made, shared := group.Stats(); made != 1 || shared != 10 {
+		t.Fatalf("unexpected stats %d made, %d shared", made, shared)
+	}
+
+	// the page is fetched again after the fetch is over.
+	if _, err := c.Fetch(WithAsOf(context.Background(), time.Now()), "Mike Tyson"); err != nil || atomic.LoadInt32(&fetches) != 2 {
+		t.Fatalf("expect a new fetch. Got %v, %d fetches", err, fetches)
+	}
+}
@@ -4,6 +4,30 @@ package worker
 type Page struct {
 	Name  string
 	Depth int
-	Prev *Page
+	Prev  *Page
 	Links map[string]bool
+
+	// Disambiguation is true if the page is a disambiguation page.
+	Disambiguation bool
+
+	// Anchors describe where the links were found on the page, if the crawler knows it.
+	Anchors map[string]Anchor
+
+	// Via is the anchor on Prev page which links to this page.
+	Via *Anchor
+}
+
+// Anchor describes where a link was found on a page.
+type Anchor struct {
+	// Text is the anchor text of the link.
+	Text string `json:"text,omitempty"`
+
+	// Section is the heading of the section with the link, empty for the lead section.
+	Section string `json:"section,omitempty"`
+
+	// Context is the sentence around the link.
+	Context string `json:"context,omitempty"`
+
+	// Label is the kind of the edge in a structured graph, e.g. Wikidata property P31.
+	Label string `json:"label,omitempty"`
 }
@@ -0,0 +1,148 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/html"
+)
+
+func init() {
+	Register("parsoid", Factory{
+		Description: "parses the links from Parsoid HTML of MediaWiki REST API (/api/rest_v1/page/html/{title})",
+		Options:     []OptionSpec{hostOption},
+		New: func(env Env, opts Options) WikiCrawler {
+			c := newParsoidWikiCrawler(env.Client)
+			c.endpoint = withHost(c.endpoint, opts)
+			c.robots = newRobotsGuard(env)
+			return c
+		},
+		Resolve: resolveWikiTitle(nil),
+	})
+}
+
+// NewParsoidWikiCrawler returns a new wiki crawler that parses Parsoid HTML
+// from MediaWiki REST API (/api/rest_v1/page/html/{title}).
+func NewParsoidWikiCrawler(client *http.Client) WikiCrawler {
+	return newParsoidWikiCrawler(client)
+}
+
+func newParsoidWikiCrawler(client *http.Client) *parsoidWikiCrawler {
+	return &parsoidWikiCrawler{
+		client: client,
+		endpoint: url.URL{
+			Scheme: "https",
+			Host:   "en.wikipedia.org",
+			Path:   "/api/rest_v1/page/html/",
+		},
+	}
+}
+
+// parsoidWikiCrawler parses Parsoid HTML. Unlike the skin html, it has stable semantic markup:
+// the wiki links are marked with rel="mw:WikiLink" and the page properties with meta tags.
+type parsoidWikiCrawler struct {
+	client *http.Client
+	robots *robotsGuard
+
+	endpoint url.URL
+}
+
+// pageURL returns the url of the page html. If the context has a time set with WithAsOf
+// it is the url of the page revision which was current at that time.
+func (c *parsoidWikiCrawler) pageURL(ctx context.Context, link string) (string, error) {
+	pageURL := c.endpoint.String() + url.PathEscape(strings.Replace(link, " ", "_", -1))
+
+	t, ok := AsOf(ctx)
+	if !ok {
+		return pageURL, nil
+	}
+
+	revID, err := resolveRevision(ctx, c.client, apiEndpoint(c.endpoint), link, t)
+	if err != nil {
+		return "", err
+	}
+	return pageURL + "/" + strconv.FormatInt(revID, 10), nil
+}
+
+// resolve returns the title of a wiki link, e.g. <a rel="mw:WikiLink" href="./Mike_Tyson" title="Mike Tyson">.
+// Links to missing pages and other namespaces are skipped.
+func (c *parsoidWikiCrawler) resolve(t html.Token) (string, bool) {
+	if !hasValue(t, "rel", "mw:WikiLink") || hasValue(t, "class", "new") {
+		return "", false
+	}
+
+	title, ok := attr(t, "title")
+	if !ok {
+		href, _ := attr(t, "href")
+		if !strings.HasPrefix(href, "./") {
+			return "", false
+		}
+
+		title = strings.TrimPrefix(href, "./")
+		if index := strings.IndexAny(title, "#?"); index > -1 {
+			title = title[:index]
+		}
+		if unescaped, err := url.PathUnescape(title); err == nil {
+			title = unescaped
+		}
+		title = strings.Replace(title, "_", " ", -1)
+	}
+
+	if title == "" || !IsArticle(title) {
+		return "", false
+	}
+	return title, true
+}
+
+// Fetch gets a link and returns a *Page which represents a page with found links.
+func (c *parsoidWikiCrawler) Fetch(ctx context.Context, link string) (*Page, error) {
+	page := &Page{
+		Name:  link,
+		Links: make(map[string]bool),
+	}
+
+	pageURL, err := c.pageURL(ctx, link)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.robots.check(ctx, pageURL); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", pageURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to make a new request: %s", err)
+	}
+
+	logrus.Debugf("GET %s", req.URL.String())
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{Code: resp.StatusCode}
+	}
+
+	anchors, err := extractLinks(resp.Body, c.resolve, func(t html.Token) {
+		if p, _ := attr(t, "property"); t.Data == "meta" && p == "mw:PageProp/disambiguation" {
+			page.Disambiguation = true
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to read response: %s", err)
+	}
+
+	for l := range anchors {
+		page.Links[l] = true
+	}
+	page.Anchors = anchors
+	return page, nil
+}
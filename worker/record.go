@@ -0,0 +1,162 @@
+package worker
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// exchange is a recorded HTTP request and response stored in a fixture file.
+type exchange struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body"`
+}
+
+// exchangeKey identifies a request. maxlag parameter is ignored, so the fixtures
+// do not depend on limits configuration.
+func exchangeKey(method string, u *url.URL) string {
+	c := *u
+	v := c.Query()
+	if _, ok := v["maxlag"]; ok {
+		v.Del("maxlag")
+		c.RawQuery = v.Encode()
+	}
+	return method + " " + c.String()
+}
+
+func fixtureName(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return hex.EncodeToString(sum[:]) + ".json"
+}
+
+// NewRecordingTransport returns a round tripper which saves every exchange made with next
+// into a fixture file in dir.
+func NewRecordingTransport(next http.RoundTripper, dir string) (http.RoundTripper, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create fixtures dir: %s", err)
+	}
+
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &recordingTransport{
+		next: next,
+		dir:  dir,
+	}, nil
+}
+
+type recordingTransport struct {
+	next http.RoundTripper
+	dir  string
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	key := exchangeKey(req.Method, req.URL)
+	data, err := json.MarshalIndent(&exchange{
+		Method: req.Method,
+		URL:    key[len(req.Method)+1:],
+		Status: resp.StatusCode,
+		Header: resp.Header,
+		Body:   string(body),
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(t.dir, fixtureName(key)), data, 0644); err != nil {
+		return nil, fmt.Errorf("unable to write fixture: %s", err)
+	}
+	return resp, nil
+}
+
+// NewReplayTransport returns a round tripper which serves the exchanges recorded in dir.
+// Requests which were not recorded fail.
+func NewReplayTransport(dir string) (http.RoundTripper, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read fixtures dir: %s", err)
+	}
+
+	t := &replayTransport{
+		exchanges: make(map[string]*exchange),
+	}
+
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read fixture %s: %s", f.Name(), err)
+		}
+
+		e := &exchange{}
+		if err := json.Unmarshal(data, e); err != nil {
+			return nil, fmt.Errorf("unable to unmarshal fixture %s: %s", f.Name(), err)
+		}
+		t.exchanges[e.Method+" "+e.URL] = e
+	}
+
+	return t, nil
+}
+
+type replayTransport struct {
+	exchanges map[string]*exchange
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := exchangeKey(req.Method, req.URL)
+	e, ok := t.exchanges[key]
+	if !ok {
+		return nil, fmt.Errorf("replay: no recorded response for %s", key)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status)),
+		StatusCode:    e.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header,
+		Body:          ioutil.NopCloser(strings.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}, nil
+}
+
+// NewReplayClient returns an http client which serves the exchanges recorded in dir.
+// Any crawler using the client replays a recorded race and fails on unseen requests.
+func NewReplayClient(dir string) (*http.Client, error) {
+	t, err := NewReplayTransport(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: t}, nil
+}
@@ -0,0 +1,69 @@
+package worker
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+)
+
+// rewriteTransport sends all requests to the test server.
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (t *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := new(http.Request)
+	*r = *req
+	u := *req.URL
+	u.Scheme = t.target.Scheme
+	u.Host = t.target.Host
+	r.URL = &u
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestRecordReplay(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"query":{"pages":{"1":{"links":[{"ns":0,"title":"AAA"},{"ns":1,"title":"Talk:AAA"}]}}}}`))
+	}))
+	target, _ := url.Parse(srv.URL)
+
+	dir, err := ioutil.TempDir("", "fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	transport, err := NewRecordingTransport(&rewriteTransport{target: target}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorded, err := NewAPIWikiCrawler(&http.Client{Transport: transport}).Fetch(context.Background(), "Mike Tyson")
+	srv.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewReplayClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crawler := NewAPIWikiCrawler(client)
+	replayed, err := crawler.Fetch(context.Background(), "Mike Tyson")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(replayed.Links) != 1 || !replayed.Links["AAA"] || len(recorded.Links) != len(replayed.Links) {
+		t.Fatalf("expect recorded links %v. Got %v", recorded.Links, replayed.Links)
+	}
+
+	if _, err := crawler.Fetch(context.Background(), "Ukraine"); err == nil {
+		t.Fatal("expect error on a request which was not recorded")
+	}
+}
@@ -0,0 +1,218 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// option types of crawler options.
+const (
+	OptionString   = "string"
+	OptionInt      = "int"
+	OptionBool     = "bool"
+	OptionDuration = "duration"
+)
+
+// OptionSpec describes a crawler option.
+type OptionSpec struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Default     string `json:"default,omitempty"`
+	Description string `json:"description"`
+}
+
+// Env is what the server provides to the crawlers.
+type Env struct {
+	// Client is an http client of the job client profile, with the upstream limits applied.
+	Client *http.Client
+
+	// UserAgent is the User-Agent of the client profile.
+	UserAgent string
+
+	// Robots is the robots.txt cache the HTML crawlers check the pages against. Nil disables the checks.
+	Robots *RobotsCache
+}
+
+// Options are the crawler options given by a job. The values are validated against
+// the factory options schema and the defaults are applied before New is called.
+type Options map[string]string
+
+// String returns an option value.
+func (o Options) String(name string) string {
+	return o[name]
+}
+
+// Int returns an option value as int.
+func (o Options) Int(name string) int {
+	i, _ := strconv.Atoi(o[name])
+	return i
+}
+
+// Bool returns an option value as bool.
+func (o Options) Bool(name string) bool {
+	b, _ := strconv.ParseBool(o[name])
+	return b
+}
+
+// Duration returns an option value as time.Duration.
+func (o Options) Duration(name string) time.Duration {
+	d, _ := time.ParseDuration(o[name])
+	return d
+}
+
+// Factory creates the crawlers of a crawl method.
+type Factory struct {
+	// Description is a human readable description of the crawl method.
+	Description string
+
+	// Options is the schema of the options the crawlers accept.
+	Options []OptionSpec
+
+	// New returns a crawler. It is called for every job worker.
+	New func(env Env, opts Options) WikiCrawler
+
+	// Normalize converts the start and destination pages given by a user to the titles
+	// the crawler returns in Page.Links, e.g. Physics -> Category:Physics. Nil keeps them as is.
+	Normalize func(opts Options, title string) string
+
+	// Resolve checks a normalized title before a race: the missing pages are reported with
+	// suggestions and the redirects are resolved to the canonical titles. Nil skips the check.
+	Resolve func(ctx context.Context, env Env, opts Options, title string) (*TitleResolution, error)
+}
+
+// Prepare validates the options against the schema and returns them with the defaults applied.
+// The values are returned in the canonical form of their type, e.g. 1 -> true for bool.
+func (f Factory) Prepare(opts map[string]string) (Options, error) {
+	prepared := Options{}
+	for _, spec := range f.Options {
+		v, ok := opts[spec.Name]
+		if !ok {
+			if spec.Default != "" {
+				prepared[spec.Name] = spec.Default
+			}
+			continue
+		}
+
+		v, err := spec.canonical(v)
+		if err != nil {
+			return nil, err
+		}
+		prepared[spec.Name] = v
+	}
+
+	for name := range opts {
+		if !f.has(name) {
+			return nil, fmt.Errorf("unknown crawler option %q", name)
+		}
+	}
+	return prepared, nil
+}
+
+func (f Factory) has(name string) bool {
+	for _, spec := range f.Options {
+		if spec.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// canonical checks the option value type and returns it formatted back.
+func (s OptionSpec) canonical(v string) (string, error) {
+	var err error
+	c := v
+	switch s.Type {
+	case OptionInt:
+		var i int
+		i, err = strconv.Atoi(v)
+		c = strconv.Itoa(i)
+	case OptionBool:
+		var b bool
+		b, err = strconv.ParseBool(v)
+		c = strconv.FormatBool(b)
+	case OptionDuration:
+		var d time.Duration
+		d, err = time.ParseDuration(v)
+		c = d.String()
+	}
+	if err != nil {
+		return "", fmt.Errorf("crawler option %s must be %s: %q", s.Name, s.Type, v)
+	}
+	return c, nil
+}
+
+// CrawlerInfo describes a registered crawl method.
+type CrawlerInfo struct {
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Options     []OptionSpec `json:"options"`
+}
+
+var registry = struct {
+	sync.RWMutex
+	factories map[string]Factory
+}{factories: make(map[string]Factory)}
+
+// Register makes a crawl method available by name. It is meant to be called from init
+// functions, so the crawlers outside of this package are plugged in by importing them.
+// Register panics if the name is already registered or the factory is incomplete.
+func Register(name string, f Factory) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if f.New == nil {
+		panic("worker: Register factory without New for " + name)
+	}
+	if _, ok := registry.factories[name]; ok {
+		panic("worker: Register called twice for " + name)
+	}
+	registry.factories[name] = f
+}
+
+// Lookup returns a registered crawl method factory.
+func Lookup(name string) (Factory, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	f, ok := registry.factories[name]
+	return f, ok
+}
+
+// Crawlers lists the registered crawl methods sorted by name.
+func Crawlers() []CrawlerInfo {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	list := make([]CrawlerInfo, 0, len(registry.factories))
+	for name, f := range registry.factories {
+		opts := f.Options
+		if opts == nil {
+			opts = []OptionSpec{}
+		}
+		list = append(list, CrawlerInfo{Name: name, Description: f.Description, Options: opts})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// hostOption lets the builtin crawlers talk to another wiki, e.g. de.wikipedia.org.
+var hostOption = OptionSpec{
+	Name:        "host",
+	Type:        OptionString,
+	Default:     "en.wikipedia.org",
+	Description: "host of the MediaWiki site to crawl",
+}
+
+// withHost returns a crawler endpoint on the host from the options.
+func withHost(endpoint url.URL, opts Options) url.URL {
+	if host := strings.TrimSpace(opts.String(hostOption.Name)); host != "" {
+		endpoint.Host = host
+	}
+	return endpoint
+}
@@ -0,0 +1,84 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	names := map[string]bool{}
+	for _, c := range Crawlers() {
+		names[c.Name] = true
+	}
+	for _, name := range []string{"api", "html", "parsoid"} {
+		if !names[name] {
+			t.Errorf("expect %s crawler to be registered", name)
+		}
+	}
+
+	f, ok := Lookup("api")
+	if !ok {
+		t.Fatal("expect api crawler")
+	}
+
+	opts, err := f.Prepare(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.String("host") != "en.wikipedia.org" {
+		t.Fatalf("expect default host. Got %q", opts.String("host"))
+	}
+
+	if _, err := f.Prepare(map[string]string{"color": "red"}); err == nil {
+		t.Fatal("expect an error for unknown option")
+	}
+}
+
+func TestRegistryOptionTypes(t *testing.T) {
+	f := Factory{
+		Options: []OptionSpec{
+			{Name: "depth", Type: OptionInt, Default: "2"},
+			{Name: "delay", Type: OptionDuration},
+		},
+		New: func(Env, Options) WikiCrawler { return nil },
+	}
+
+	opts, err := f.Prepare(map[string]string{"delay": "1s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Int("depth") != 2 || opts.Duration("delay").String() != "1s" {
+		t.Fatalf("unexpected options %v", opts)
+	}
+
+	if _, err := f.Prepare(map[string]string{"depth": "deep"}); err == nil {
+		t.Fatal("expect an error for invalid int")
+	}
+}
+
+func TestRegistryHostOption(t *testing.T) {
+	var host string
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		host = req.URL.Host
+		return nil, errors.New("offline")
+	})}
+
+	f, _ := Lookup("api")
+	opts, err := f.Prepare(map[string]string{"host": "de.wikipedia.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.New(Env{Client: client}, opts).Fetch(context.Background(), "Boxen")
+	if host != "de.wikipedia.org" {
+		t.Fatalf("expect a request to de.wikipedia.org. Got %q", host)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,164 @@
+package worker
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// maxSuggestions is the number of titles suggested for a missing page.
+const maxSuggestions = 5
+
+// TitleResolution tells how a title given by a user was resolved before a race.
+type TitleResolution struct {
+	// Requested is the title as given by the user.
+	Requested string `json:"requested"`
+
+	// Title is the canonical title, the target of a redirect.
+	Title string `json:"title"`
+
+	// Redirect is true if Requested is a redirect to Title.
+	Redirect bool `json:"redirect,omitempty"`
+
+	// Disambiguation is true if Title is a disambiguation page.
+	Disambiguation bool `json:"disambiguation,omitempty"`
+
+	// Missing is true if the page does not exist. Suggestions are the titles the user may have meant.
+	Missing     bool     `json:"missing,omitempty"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+// ResolveTitle looks up a title with MediaWiki API endpoint: the title is normalized and the redirects
+// are followed. The titles similar to a missing one are suggested from the search.
+func ResolveTitle(ctx context.Context, client *http.Client, endpoint url.URL, title string) (*TitleResolution, error) {
+	var r struct {
+		Query struct {
+			Normalized []struct {
+				From string `json:"from"`
+				To   string `json:"to"`
+			} `json:"normalized"`
+			Redirects []struct {
+				From string `json:"from"`
+				To   string `json:"to"`
+			} `json:"redirects"`
+			Pages map[string]struct {
+				Ns        int               `json:"ns"`
+				Title     string            `json:"title"`
+				Missing   *string           `json:"missing"`
+				Invalid   *string           `json:"invalid"`
+				PageProps map[string]string `json:"pageprops"`
+			} `json:"pages"`
+		} `json:"query"`
+	}
+
+	v := url.Values{}
+	v.Set("action", "query")
+	v.Set("titles", title)
+	v.Set("redirects", "1")
+	v.Set("prop", "pageprops")
+	v.Set("ppprop", "disambiguation")
+	if err := queryAPI(ctx, client, endpoint, v, &r); err != nil {
+		return nil, err
+	}
+
+	res := &TitleResolution{Requested: title, Title: title}
+	for _, n := range r.Query.Normalized {
+		if n.From == res.Title {
+			res.Title = n.To
+		}
+	}
+	for _, rd := range r.Query.Redirects {
+		if rd.From == res.Title {
+			res.Title, res.Redirect = rd.To, true
+		}
+	}
+
+	ns := NamespaceMain
+	for _, p := range r.Query.Pages {
+		if p.Title != res.Title && p.Invalid == nil {
+			continue
+		}
+		ns = p.Ns
+		res.Missing = p.Missing != nil || p.Invalid != nil
+		_, res.Disambiguation = p.PageProps["disambiguation"]
+	}
+
+	if !res.Missing {
+		return res, nil
+	}
+
+	// the search finds the similar titles, its spelling suggestion is searched too as it is often
+	// what the user meant, e.g. Ukrane -> ukraine.
+	titles, suggestion, err := searchTitles(ctx, client, endpoint, title, ns)
+	if err != nil {
+		return nil, err
+	}
+	if suggestion != "" {
+		suggested, _, err := searchTitles(ctx, client, endpoint, suggestion, ns)
+		if err != nil {
+			return nil, err
+		}
+		titles = append(suggested, titles...)
+	}
+
+	seen := map[string]bool{}
+	for _, t := range titles {
+		if !seen[t] && len(res.Suggestions) < maxSuggestions {
+			seen[t] = true
+			res.Suggestions = append(res.Suggestions, t)
+		}
+	}
+	return res, nil
+}
+
+// searchTitles returns the titles found by the full text search in namespace ns and the spelling
+// suggestion of the search, if any.
+func searchTitles(ctx context.Context, client *http.Client, endpoint url.URL, query string, ns int) ([]string, string, error) {
+	var r struct {
+		Query struct {
+			SearchInfo struct {
+				Suggestion string `json:"suggestion"`
+			} `json:"searchinfo"`
+			Search []struct {
+				Title string `json:"title"`
+			} `json:"search"`
+		} `json:"query"`
+	}
+
+	v := url.Values{}
+	v.Set("action", "query")
+	v.Set("list", "search")
+	v.Set("srsearch", query)
+	v.Set("srnamespace", strconv.Itoa(ns))
+	v.Set("srlimit", strconv.Itoa(maxSuggestions))
+	v.Set("srinfo", "suggestion")
+	v.Set("srprop", "")
+	if err := queryAPI(ctx, client, endpoint, v, &r); err != nil {
+		return nil, "", err
+	}
+
+	titles := make([]string, 0, len(r.Query.Search))
+	for _, s := range r.Query.Search {
+		titles = append(titles, s.Title)
+	}
+	return titles, r.Query.SearchInfo.Suggestion, nil
+}
+
+// resolveWikiTitle returns a Factory.Resolve of the crawlers reading MediaWiki pages of the host option.
+// format converts the canonical title to the form the crawler uses in Page.Links.
+func resolveWikiTitle(format func(string) string) func(ctx context.Context, env Env, opts Options, title string) (*TitleResolution, error) {
+	return func(ctx context.Context, env Env, opts Options, title string) (*TitleResolution, error) {
+		endpoint := withHost(url.URL{Scheme: "https", Host: "en.wikipedia.org", Path: "/w/api.php"}, opts)
+		res, err := ResolveTitle(ctx, env.Client, endpoint, title)
+		if err != nil || format == nil {
+			return res, err
+		}
+
+		res.Title = format(res.Title)
+		for i, s := range res.Suggestions {
+			res.Suggestions[i] = format(s)
+		}
+		return res, nil
+	}
+}
@@ -0,0 +1,49 @@
+package worker
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/darkonie/wikiracer/fakewiki"
+)
+
+func TestResolveTitle(t *testing.T) {
+	srv := fakewiki.NewServer(fakewiki.RedirectGraph{
+		Graph: fakewiki.MapGraph{
+			"Mike Tyson":               {},
+			"Mike Tyson filmography":   {},
+			"Mercury (disambiguation)": {},
+		},
+		Redirects: map[string]string{"Iron Mike": "Mike Tyson"},
+	}, 0)
+	defer srv.Close()
+
+	endpoint := url.URL{Scheme: "https", Host: "en.wikipedia.org", Path: "/w/api.php"}
+	resolve := func(title string) *TitleResolution {
+		res, err := ResolveTitle(context.Background(), srv.Client(), endpoint, title)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	if res := resolve("Iron_Mike"); res.Title != "Mike Tyson" || !res.Redirect || res.Missing {
+		t.Errorf("expect redirect to Mike Tyson. Got %+v", res)
+	}
+
+	if res := resolve("Mercury (disambiguation)"); !res.Disambiguation || res.Redirect {
+		t.Errorf("expect disambiguation page. Got %+v", res)
+	}
+
+	res := resolve("Mike Tysn")
+	if !res.Missing || !reflect.DeepEqual(res.Suggestions, []string{"Mike Tyson", "Mike Tyson filmography"}) {
+		t.Errorf("expect missing page with a suggestion. Got %+v", res)
+	}
+
+	res = resolve("Mike Tyson film")
+	if !res.Missing || !reflect.DeepEqual(res.Suggestions, []string{"Mike Tyson filmography"}) {
+		t.Errorf("expect missing page with a search result. Got %+v", res)
+	}
+}
@@ -0,0 +1,363 @@
+package worker
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/darkonie/wikiracer/primitives"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrDisallowed is returned when robots.txt does not allow the crawler to fetch a page.
+var ErrDisallowed = errors.New("disallowed by robots.txt")
+
+// IsDisallowed returns true if the fetch failed because robots.txt does not allow it.
+func IsDisallowed(err error) bool {
+	return cause(err) == ErrDisallowed
+}
+
+// ErrRobotsUnavailable is returned while the robots.txt of a host is unreachable, the pages
+// of the host must not be fetched until it is back.
+var ErrRobotsUnavailable = errors.New("robots.txt is unreachable")
+
+// maxRobotsSize is the size of robots.txt read, the rest is ignored as RFC 9309 allows.
+const maxRobotsSize = 500 << 10
+
+// robotsRetry is how long an unreachable robots.txt is cached, the host is unavailable meanwhile.
+const robotsRetry = time.Minute
+
+// NewRobotsCache returns a cache of robots.txt files shared by the crawlers. The files are
+// refreshed after ttl, zero means a day.
+func NewRobotsCache(ttl time.Duration) *RobotsCache {
+	return &RobotsCache{
+		ttl:     ttl,
+		entries: make(map[string]*robotsEntry),
+		delays:  make(map[string]*primitives.TokenBucket),
+	}
+}
+
+// RobotsCache fetches, caches and applies robots.txt rules and Crawl-delay.
+type RobotsCache struct {
+	sync.Mutex
+
+	ttl     time.Duration
+	entries map[string]*robotsEntry
+	delays  map[string]*primitives.TokenBucket
+}
+
+// robotsEntry is a robots.txt of an origin, ready is closed when it is fetched.
+type robotsEntry struct {
+	ready   chan struct{}
+	robots  *robotsTxt
+	expires time.Time
+}
+
+// Check returns ErrDisallowed if the user agent may not fetch u and ErrRobotsUnavailable if
+// the robots.txt of the host is unreachable. Otherwise it waits for the Crawl-delay of the host,
+// so the pages of a host are fetched one by one at most once per delay. The wait does not count
+// against the fetch Timeout. The robots.txt is fetched with client on the first check of a host.
+func (r *RobotsCache) Check(ctx context.Context, client *http.Client, userAgent string, u *url.URL) error {
+	robots, err := r.robots(ctx, client, u)
+	if err != nil {
+		return err
+	}
+	if robots == unreachable {
+		return ErrRobotsUnavailable
+	}
+
+	token := agentToken(userAgent)
+	g := robots.group(token)
+	if g == nil {
+		return nil
+	}
+
+	if !g.allowed(u) {
+		return ErrDisallowed
+	}
+
+	if g.delay <= 0 {
+		return nil
+	}
+
+	// the fetch is waiting for its turn, not for the upstream.
+	resume := pauseTimeout(ctx)
+	defer resume()
+	return r.delay(origin(u)+" "+token, g.delay).Wait(ctx)
+}
+
+func (r *RobotsCache) delay(key string, d time.Duration) *primitives.TokenBucket {
+	r.Lock()
+	defer r.Unlock()
+
+	b, ok := r.delays[key]
+	if !ok {
+		b = primitives.NewTokenBucket(float64(time.Second)/float64(d), 1)
+		r.delays[key] = b
+	}
+	return b
+}
+
+// robots returns the robots.txt of the u origin, the concurrent callers wait for a single fetch.
+func (r *RobotsCache) robots(ctx context.Context, client *http.Client, u *url.URL) (*robotsTxt, error) {
+	key := origin(u)
+	for {
+		r.Lock()
+		e, ok := r.entries[key]
+		if ok {
+			select {
+			case <-e.ready:
+				ok = time.Now().Before(e.expires)
+			default:
+			}
+		}
+		if !ok {
+			e = &robotsEntry{ready: make(chan struct{})}
+			r.entries[key] = e
+		}
+		r.Unlock()
+
+		if !ok {
+			r.fetch(ctx, client, u, key, e)
+		}
+
+		select {
+		case <-e.ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		// the fetch was cancelled, try again.
+		if e.robots != nil {
+			return e.robots, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// fetch fills the entry. If ctx is done meanwhile, the entry is dropped, so the next caller fetches it again.
+func (r *RobotsCache) fetch(ctx context.Context, client *http.Client, u *url.URL, key string, e *robotsEntry) {
+	robots, ttl := fetchRobots(ctx, client, u)
+	if r.ttl > 0 && ttl > r.ttl {
+		ttl = r.ttl
+	}
+
+	r.Lock()
+	if ctx.Err() != nil {
+		delete(r.entries, key)
+	} else {
+		e.robots, e.expires = robots, time.Now().Add(ttl)
+	}
+	r.Unlock()
+	close(e.ready)
+}
+
+// fetchRobots downloads and parses robots.txt of the u origin and returns how long to keep it.
+// As RFC 9309 says, a missing file allows everything and an unreachable one disallows everything,
+// until it is reachable again.
+func fetchRobots(ctx context.Context, client *http.Client, u *url.URL) (*robotsTxt, time.Duration) {
+	robotsURL := url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+	req, err := http.NewRequest("GET", robotsURL.String(), nil)
+	if err != nil {
+		return unreachable, robotsRetry
+	}
+
+	logrus.Debugf("GET %s", robotsURL.String())
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		logrus.Warnf("unable to fetch %s: %s", robotsURL.String(), err)
+		return unreachable, robotsRetry
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		logrus.Warnf("unable to fetch %s: %s", robotsURL.String(), &StatusError{Code: resp.StatusCode})
+		return unreachable, robotsRetry
+	case resp.StatusCode >= 400:
+		return allowAll, time.Hour * 24
+	}
+
+	return parseRobots(io.LimitReader(resp.Body, maxRobotsSize)), time.Hour * 24
+}
+
+// robotsTxt is a parsed robots.txt.
+type robotsTxt struct {
+	groups []*robotsGroup
+}
+
+var (
+	allowAll    = &robotsTxt{}
+	unreachable = &robotsTxt{}
+)
+
+// robotsGroup is a group of rules for the user agents.
+type robotsGroup struct {
+	agents []string
+	rules  []robotsRule
+	delay  time.Duration
+}
+
+// robotsRule is an Allow or Disallow line.
+type robotsRule struct {
+	allow   bool
+	pattern string
+	re      *regexp.Regexp
+}
+
+// parseRobots parses robots.txt, the lines it does not understand are ignored.
+func parseRobots(r io.Reader) *robotsTxt {
+	robots := &robotsTxt{}
+
+	var g *robotsGroup
+	// agents is true while reading the user-agent lines of a group.
+	agents := false
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		value := strings.TrimSpace(line[i+1:])
+
+		if key == "user-agent" {
+			if !agents {
+				g = &robotsGroup{}
+				robots.groups = append(robots.groups, g)
+				agents = true
+			}
+			g.agents = append(g.agents, strings.ToLower(value))
+			continue
+		}
+		agents = false
+
+		if g == nil {
+			continue
+		}
+
+		switch key {
+		case "allow", "disallow":
+			// an empty disallow allows everything, same as no rule.
+			if value == "" {
+				continue
+			}
+			re, err := robotsPattern(value)
+			if err != nil {
+				continue
+			}
+			g.rules = append(g.rules, robotsRule{allow: key == "allow", pattern: value, re: re})
+		case "crawl-delay":
+			if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+				g.delay = time.Duration(secs * float64(time.Second))
+			}
+		}
+	}
+	return robots
+}
+
+// robotsPattern compiles a path pattern with * wildcards and $ end anchor.
+func robotsPattern(p string) (*regexp.Regexp, error) {
+	end := strings.HasSuffix(p, "$")
+	p = strings.TrimSuffix(p, "$")
+
+	expr := "^" + strings.Replace(regexp.QuoteMeta(p), `\*`, ".*", -1)
+	if end {
+		expr += "$"
+	}
+	return regexp.Compile(expr)
+}
+
+// agentToken returns the product token of a user agent matched against robots.txt,
+// e.g. wikiracer for wikiracer/1.0 (https://github.com/darkonie/wikiracer).
+func agentToken(userAgent string) string {
+	token := strings.ToLower(strings.TrimSpace(userAgent))
+	if i := strings.IndexAny(token, "/ "); i >= 0 {
+		token = token[:i]
+	}
+	return token
+}
+
+// group returns the group of the user agent token or the * group. Nil means no rules.
+func (r *robotsTxt) group(token string) *robotsGroup {
+	var star *robotsGroup
+	for _, g := range r.groups {
+		for _, a := range g.agents {
+			switch a {
+			case token:
+				return g
+			case "*":
+				if star == nil {
+					star = g
+				}
+			}
+		}
+	}
+	return star
+}
+
+// allowed applies the most specific, i.e. the longest, matching rule. Allow wins a tie.
+func (g *robotsGroup) allowed(u *url.URL) bool {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	allow, length := true, -1
+	for _, rule := range g.rules {
+		if !rule.re.MatchString(path) {
+			continue
+		}
+		if len(rule.pattern) > length || (len(rule.pattern) == length && rule.allow) {
+			allow, length = rule.allow, len(rule.pattern)
+		}
+	}
+	return allow
+}
+
+// robotsGuard checks the pages against robots.txt before the HTML crawlers fetch them.
+// A nil guard or cache allows everything.
+type robotsGuard struct {
+	cache     *RobotsCache
+	client    *http.Client
+	userAgent string
+}
+
+func newRobotsGuard(env Env) *robotsGuard {
+	return &robotsGuard{
+		cache:     env.Robots,
+		client:    env.Client,
+		userAgent: env.UserAgent,
+	}
+}
+
+func (g *robotsGuard) check(ctx context.Context, pageURL string) error {
+	if g == nil || g.cache == nil {
+		return nil
+	}
+
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return fmt.Errorf("invalid page url %q: %s", pageURL, err)
+	}
+	return g.cache.Check(ctx, g.client, g.userAgent, u)
+}
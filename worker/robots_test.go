@@ -0,0 +1,224 @@
+package worker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/darkonie/wikiracer/fakewiki"
+)
+
+const testRobots = `# comment
+User-agent: *
+Disallow: /w/
+Allow: /w/load.php
+Disallow: /*.pdf$
+
+User-agent: WikiRacer
+User-agent: other
+Disallow: /private
+Crawl-delay: 0.05
+`
+
+func TestParseRobots(t *testing.T) {
+	robots := parseRobots(strings.NewReader(testRobots))
+
+	star := robots.group(agentToken("curl/7.0"))
+	for path, allowed := range map[string]bool{
+		"/wiki/Mike_Tyson":          true,
+		"/w/index.php?oldid=1":      false,
+		"/w/load.php":               true,
+		"/files/report.pdf":         false,
+		"/files/report.pdf?page=2":  true,
+		"/":                         true,
+		"/wiki/Category:Physics":    true,
+		"/w/api.php?action=query":   false,
+		"/private/notes":            true,
+		"/files/report.pdf/preview": true,
+	} {
+		u, _ := url.Parse("https://en.wikipedia.org" + path)
+		if star.allowed(u) != allowed {
+			t.Errorf("expect %s allowed %t for *", path, allowed)
+		}
+	}
+
+	g := robots.group(agentToken(DefaultUserAgent))
+	if g == star {
+		t.Fatal("expect wikiracer group")
+	}
+	if u, _ := url.Parse("https://en.wikipedia.org/private/notes"); g.allowed(u) {
+		t.Error("expect /private disallowed for wikiracer")
+	}
+	if u, _ := url.Parse("https://en.wikipedia.org/w/index.php"); !g.allowed(u) {
+		t.Error("expect /w/ allowed for wikiracer, * group does not apply")
+	}
+	if g.delay != 50*time.Millisecond {
+		t.Errorf("expect crawl-delay 50ms. Got %s", g.delay)
+	}
+}
+
+func TestRobotsCache(t *testing.T) {
+	var fetches int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.Write([]byte(testRobots))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	cache := NewRobotsCache(time.Hour)
+	check := func(path string) error {
+		u, _ := url.Parse(srv.URL + path)
+		return cache.Check(context.Background(), srv.Client(), DefaultUserAgent, u)
+	}
+
+	if err := check("/private"); err != ErrDisallowed {
+		t.Errorf("expect ErrDisallowed. Got %v", err)
+	}
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := check("/wiki/Mike_Tyson"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Errorf("expect crawl-delay between the fetches. Took %s", d)
+	}
+
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("expect robots.txt fetched once. Got %d", n)
+	}
+}
+
+func TestRobotsUnavailable(t *testing.T) {
+	for code, allowed := range map[int]bool{
+		http.StatusNotFound:            true,
+		http.StatusForbidden:           true,
+		http.StatusServiceUnavailable:  false,
+		http.StatusInternalServerError: false,
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		}))
+
+		u, _ := url.Parse(srv.URL + "/wiki/Mike_Tyson")
+		err := NewRobotsCache(0).Check(context.Background(), srv.Client(), DefaultUserAgent, u)
+		if (err == nil) != allowed || (!allowed && !IsUnavailable(err)) {
+			t.Errorf("expect allowed %t for robots.txt status %d. Got %v", allowed, code, err)
+		}
+		if IsDisallowed(err) {
+			t.Errorf("expect the pages retried, not skipped, for robots.txt status %d", code)
+		}
+		srv.Close()
+	}
+}
+
+func TestRobotsDelayTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testRobots))
+	}))
+	defer srv.Close()
+
+	cache := NewRobotsCache(0)
+	c := Chain(CrawlerFunc(func(ctx context.Context, link string) (*Page, error) {
+		u, _ := url.Parse(srv.URL + link)
+		if err := cache.Check(ctx, srv.Client(), DefaultUserAgent, u); err != nil {
+			return nil, err
+		}
+		return &Page{Name: link}, nil
+	}), Timeout(time.Millisecond*30))
+
+	// the crawl-delay is longer than the timeout.
+	for i := 0; i < 3; i++ {
+		if _, err := c.Fetch(context.Background(), "/wiki/Mike_Tyson"); err != nil {
+			t.Fatalf("expect the crawl-delay wait not to time out. Got %v", err)
+		}
+	}
+
+	slow := Chain(CrawlerFunc(func(ctx context.Context, link string) (*Page, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}), Timeout(time.Millisecond*10))
+	if _, err := slow.Fetch(context.Background(), "/wiki/Mike_Tyson"); ErrorKind(err) != ErrKindTimeout {
+		t.Fatalf("expect a timeout. Got %v", err)
+	}
+}
+
+// wikipediaRobots is an excerpt of https://en.wikipedia.org/robots.txt.
+const wikipediaRobots = `User-agent: *
+Allow: /w/api.php?action=mobileview&
+Allow: /w/load.php?
+Allow: /api/rest_v1/?doc
+Disallow: /w/
+Disallow: /api/
+Disallow: /trap/
+Disallow: /wiki/Special:
+`
+
+func TestWikipediaRobots(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(wikipediaRobots))
+	})
+	mux.Handle("/", fakewiki.NewHandler(fakewiki.MapGraph{"Mike Tyson": {"Boxing"}, "Boxing": nil}, 0))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	target, _ := url.Parse(srv.URL)
+	client := &http.Client{Transport: &rewriteTransport{target: target}}
+	env := Env{Client: client, UserAgent: DefaultUserAgent, Robots: NewRobotsCache(0)}
+	crawler := func(method string) WikiCrawler {
+		f, _ := Lookup(method)
+		opts, _ := f.Prepare(nil)
+		return f.New(env, opts)
+	}
+
+	if _, err := crawler("html").Fetch(context.Background(), "Mike_Tyson"); err != nil {
+		t.Fatalf("expect the live html pages allowed. Got %v", err)
+	}
+
+	// the REST API and the old revisions are disallowed for the crawlers.
+	asOf := WithAsOf(context.Background(), time.Now())
+	if _, err := crawler("html").Fetch(asOf, "Mike_Tyson"); !IsDisallowed(err) {
+		t.Fatalf("expect the html revisions disallowed. Got %v", err)
+	}
+	if _, err := crawler("parsoid").Fetch(context.Background(), "Mike Tyson"); !IsDisallowed(err) {
+		t.Fatalf("expect the parsoid pages disallowed. Got %v", err)
+	}
+}
+
+func TestHTMLCrawlerRobots(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("User-agent: *\nDisallow: /wiki/Secret\n"))
+	})
+	mux.HandleFunc("/wiki/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<a href="/wiki/Secret">secret</a>`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	endpoint, _ := url.Parse(srv.URL + "/wiki/")
+	c := newHTMLWikiCrawler(srv.Client())
+	c.endpoint = *endpoint
+	c.robots = newRobotsGuard(Env{Client: srv.Client(), UserAgent: DefaultUserAgent, Robots: NewRobotsCache(0)})
+
+	page, err := c.Fetch(context.Background(), "Mike_Tyson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !page.Links["Secret"] {
+		t.Errorf("expect a link to Secret. Got %v", page.Links)
+	}
+
+	if _, err := c.Fetch(context.Background(), "Secret"); !IsDisallowed(err) {
+		t.Errorf("expect ErrDisallowed. Got %v", err)
+	}
+}
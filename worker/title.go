@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"strings"
+)
+
+// MediaWiki namespaces the crawlers care about.
+const (
+	NamespaceMain     = 0
+	NamespaceCategory = 14
+)
+
+// namespaces maps the lower case namespace prefixes of English Wikipedia, including aliases,
+// to namespace numbers. See https://en.wikipedia.org/wiki/Wikipedia:Namespace.
+var namespaces = map[string]int{
+	"media":                  -2,
+	"special":                -1,
+	"talk":                   1,
+	"user":                   2,
+	"user talk":              3,
+	"wikipedia":              4,
+	"wp":                     4,
+	"project":                4,
+	"wikipedia talk":         5,
+	"wt":                     5,
+	"project talk":           5,
+	"file":                   6,
+	"image":                  6,
+	"file talk":              7,
+	"image talk":             7,
+	"mediawiki":              8,
+	"mediawiki talk":         9,
+	"template":               10,
+	"t":                      10,
+	"template talk":          11,
+	"help":                   12,
+	"help talk":              13,
+	"category":               NamespaceCategory,
+	"cat":                    NamespaceCategory,
+	"category talk":          15,
+	"portal":                 100,
+	"p":                      100,
+	"portal talk":            101,
+	"draft":                  118,
+	"draft talk":             119,
+	"timedtext":              710,
+	"timedtext talk":         711,
+	"module":                 828,
+	"module talk":            829,
+	"gadget":                 2300,
+	"gadget talk":            2301,
+	"gadget definition":      2302,
+	"gadget definition talk": 2303,
+}
+
+// Namespace returns the namespace number of a title, e.g. 14 for Category:Physics.
+// A colon alone does not make a namespace, Star Wars: Episode IV is in the main namespace.
+func Namespace(title string) int {
+	index := strings.Index(title, ":")
+	if index < 0 {
+		return NamespaceMain
+	}
+
+	prefix := strings.ToLower(strings.TrimSpace(strings.Replace(title[:index], "_", " ", -1)))
+	if ns, ok := namespaces[prefix]; ok {
+		return ns
+	}
+	return NamespaceMain
+}
+
+// IsArticle returns true if the title is in the main namespace.
+func IsArticle(title string) bool {
+	return Namespace(title) == NamespaceMain
+}
@@ -0,0 +1,20 @@
+package worker
+
+import "testing"
+
+func TestNamespace(t *testing.T) {
+	for title, ns := range map[string]int{
+		"Mike Tyson":             NamespaceMain,
+		"Star Wars: Episode IV":  NamespaceMain,
+		"Category:Physics":       NamespaceCategory,
+		"category:Physics":       NamespaceCategory,
+		"Talk:Mike Tyson":        1,
+		"User_talk:Jimbo_Wales":  3,
+		"Wikipedia:Village pump": 4,
+		"Special:Random":         -1,
+	} {
+		if got := Namespace(title); got != ns {
+			t.Errorf("expect namespace %d for %s. Got %d", ns, title, got)
+		}
+	}
+}
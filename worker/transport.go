@@ -0,0 +1,163 @@
+package worker
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/darkonie/wikiracer/primitives"
+	"github.com/sirupsen/logrus"
+)
+
+// LimitConfig describes how upstream requests are throttled.
+type LimitConfig struct {
+	// Rate is the number of requests per second allowed per upstream host. 0 disables limiting.
+	Rate float64
+
+	// Burst is the number of requests which can be sent at once.
+	Burst int
+
+	// MaxLag is the MediaWiki maxlag parameter in seconds added to api.php requests. 0 disables it.
+	MaxLag int
+
+	// MaxRetries is the number of times a request is retried after 429, 503 or maxlag response.
+	MaxRetries int
+}
+
+// NewHostLimiter returns per host request limits. A limiter can be shared by several
+// transports, so all of them are throttled together.
+func NewHostLimiter(cfg LimitConfig) *HostLimiter {
+	return &HostLimiter{
+		cfg:   cfg,
+		hosts: make(map[string]*primitives.TokenBucket),
+	}
+}
+
+// HostLimiter keeps a token bucket per upstream host.
+type HostLimiter struct {
+	sync.Mutex
+
+	cfg   LimitConfig
+	hosts map[string]*primitives.TokenBucket
+}
+
+func (l *HostLimiter) bucket(host string) *primitives.TokenBucket {
+	l.Lock()
+	defer l.Unlock()
+
+	b, ok := l.hosts[host]
+	if !ok {
+		b = primitives.NewTokenBucket(l.cfg.Rate, l.cfg.Burst)
+		l.hosts[host] = b
+	}
+	return b
+}
+
+// NewLimitedTransport wraps the next round tripper with per host rate limiting.
+// The limits are shared by all transports using the same limiter.
+func NewLimitedTransport(next http.RoundTripper, limiter *HostLimiter) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &limitedTransport{
+		next:    next,
+		limiter: limiter,
+		cfg:     limiter.cfg,
+	}
+}
+
+// limitedTransport throttles the requests and backs off when the upstream asks to.
+type limitedTransport struct {
+	next    http.RoundTripper
+	limiter *HostLimiter
+	cfg     LimitConfig
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.cfg.MaxLag > 0 && strings.HasSuffix(req.URL.Path, "api.php") {
+		req = withMaxLag(req, t.cfg.MaxLag)
+	}
+
+	b := t.limiter.bucket(req.URL.Host)
+	for attempt := 0; ; attempt++ {
+		if err := b.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+
+		resp, err := t.next.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+
+		delay, ok := backoff(resp, attempt)
+		if !ok {
+			return resp, nil
+		}
+
+		// requests with a body cannot be replayed.
+		if attempt >= t.cfg.MaxRetries || req.Body != nil {
+			return resp, nil
+		}
+
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+
+		logrus.Warnf("upstream %s asked to back off (status %d), retrying in %s", req.URL.Host, resp.StatusCode, delay)
+		b.Block(delay)
+	}
+}
+
+// backoff returns the time to wait before repeating the request and false if the response
+// does not need to be retried.
+func backoff(resp *http.Response, attempt int) (time.Duration, bool) {
+	maxLag := resp.Header.Get("MediaWiki-API-Error") == "maxlag"
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable && !maxLag {
+		return 0, false
+	}
+
+	if d, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+		return d, true
+	}
+
+	return time.Second << uint(attempt), true
+}
+
+// parseRetryAfter parses Retry-After header which can be either seconds or HTTP date.
+func parseRetryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+
+	return 0, false
+}
+
+// withMaxLag returns a shallow copy of req with maxlag query parameter.
+func withMaxLag(req *http.Request, maxLag int) *http.Request {
+	r := new(http.Request)
+	*r = *req
+
+	u := *req.URL
+	v := u.Query()
+	v.Set("maxlag", strconv.Itoa(maxLag))
+	u.RawQuery = v.Encode()
+	r.URL = &u
+	return r
+}
@@ -0,0 +1,47 @@
+package worker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLimitedTransportRetry(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Query().Get("maxlag") != "5" {
+			t.Errorf("expect maxlag=5. Got %s", r.URL.RawQuery)
+		}
+
+		switch calls {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.Header().Set("MediaWiki-API-Error", "maxlag")
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer srv.Close()
+
+	client := &http.Client{
+		Transport: NewLimitedTransport(nil, NewHostLimiter(LimitConfig{Rate: 100, Burst: 1, MaxLag: 5, MaxRetries: 3})),
+	}
+
+	resp, err := client.Get(srv.URL + "/w/api.php?action=query")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expect status 200. Got %d", resp.StatusCode)
+	}
+
+	if calls != 3 {
+		t.Fatalf("expect 3 calls. Got %d", calls)
+	}
+}
@@ -0,0 +1,230 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/html"
+)
+
+func init() {
+	Register("web", Factory{
+		Description: "races between two URLs of any website following the same origin <a href> links",
+		Options: []OptionSpec{
+			{
+				Name:        "keep_query",
+				Type:        OptionBool,
+				Default:     "false",
+				Description: "keep the query parameters, sorted, as a part of the page URL. By default they are dropped",
+			},
+		},
+		New: func(env Env, opts Options) WikiCrawler {
+			c := newWebCrawler(env.Client, opts.Bool("keep_query"))
+			c.robots = newRobotsGuard(env)
+			return c
+		},
+		Normalize: func(opts Options, link string) string {
+			if c, err := CanonicalURL(link, opts.Bool("keep_query")); err == nil {
+				return c
+			}
+			return link
+		},
+	})
+}
+
+// maxWebPageSize limits the size of a web page read by the web crawler.
+const maxWebPageSize = 10 << 20
+
+// NewWebCrawler returns a crawler of a website. The pages are canonical URLs, see CanonicalURL,
+// and the links are the same origin <a href> links.
+func NewWebCrawler(client *http.Client, keepQuery bool) WikiCrawler {
+	return newWebCrawler(client, keepQuery)
+}
+
+func newWebCrawler(client *http.Client, keepQuery bool) *webCrawler {
+	return &webCrawler{
+		client:    client,
+		keepQuery: keepQuery,
+	}
+}
+
+// webCrawler parses html pages of any website.
+type webCrawler struct {
+	client    *http.Client
+	robots    *robotsGuard
+	keepQuery bool
+}
+
+// CanonicalURL returns the canonical form of an absolute http(s) URL, so the links to the same page
+// are equal: the scheme and host are lower case, the default port, the fragment and the trailing
+// slash are removed, an empty path is /. The query is removed unless keepQuery is true,
+// then its parameters are sorted.
+func CanonicalURL(raw string, keepQuery bool) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", err
+	}
+	return canonical(u, keepQuery)
+}
+
+func canonical(u *url.URL, keepQuery bool) (string, error) {
+	c := *u
+	c.Scheme = strings.ToLower(c.Scheme)
+	if c.Scheme != "http" && c.Scheme != "https" {
+		return "", fmt.Errorf("unsupported url scheme %q", c.Scheme)
+	}
+	if c.Host == "" {
+		return "", fmt.Errorf("url %q is not absolute", u)
+	}
+
+	c.Host = strings.ToLower(c.Host)
+	if port := c.Port(); (c.Scheme == "http" && port == "80") || (c.Scheme == "https" && port == "443") {
+		c.Host = c.Hostname()
+	}
+
+	c.User = nil
+	c.Fragment = ""
+	c.RawFragment = ""
+	c.Opaque = ""
+
+	// resolve the dot segments.
+	c = *c.ResolveReference(&url.URL{Path: c.Path})
+	if c.Path == "" {
+		c.Path = "/"
+	}
+	if len(c.Path) > 1 {
+		c.Path = strings.TrimRight(c.Path, "/")
+		if c.Path == "" {
+			c.Path = "/"
+		}
+	}
+	c.RawPath = ""
+
+	c.RawQuery = ""
+	c.ForceQuery = false
+	if keepQuery {
+		c.RawQuery = sortedQuery(u.Query())
+	}
+	return c.String(), nil
+}
+
+// sortedQuery encodes the query parameters sorted by key, keeping the order of the values.
+func sortedQuery(v url.Values) string {
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		for _, value := range v[k] {
+			parts = append(parts, url.QueryEscape(k)+"="+url.QueryEscape(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// sameOrigin returns true if the urls have the same scheme, host and port.
+func sameOrigin(a, b *url.URL) bool {
+	return origin(a) == origin(b)
+}
+
+// origin returns the scheme, host and port of the url, the port is explicit.
+func origin(u *url.URL) string {
+	scheme := strings.ToLower(u.Scheme)
+	port := u.Port()
+	if port == "" {
+		switch scheme {
+		case "http":
+			port = "80"
+		case "https":
+			port = "443"
+		}
+	}
+	return scheme + "://" + strings.ToLower(u.Hostname()) + ":" + port
+}
+
+// Fetch gets a page by URL and returns the links found on it which have the same origin as
+// the requested URL, so a redirect to another site does not take the race there.
+// The links are resolved against the final URL after redirects or the <base href> of the page.
+func (c *webCrawler) Fetch(ctx context.Context, link string) (*Page, error) {
+	if _, ok := AsOf(ctx); ok {
+		return nil, ErrAsOfUnsupported
+	}
+
+	page := &Page{
+		Name:  link,
+		Links: make(map[string]bool),
+	}
+
+	if err := c.robots.check(ctx, link); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", link, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to make a new request: %s", err)
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	logrus.Debugf("GET %s", req.URL.String())
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{Code: resp.StatusCode}
+	}
+
+	// the links of the other documents, e.g. images or pdf files, lead nowhere.
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "" && mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return page, nil
+	}
+
+	// skip the links to the page itself, it could be redirected.
+	final := resp.Request.URL
+	self, _ := canonical(final, c.keepQuery)
+	base := final
+	anchors, err := extractLinks(io.LimitReader(resp.Body, maxWebPageSize), func(t html.Token) (string, bool) {
+		href, ok := attr(t, "href")
+		if !ok {
+			return "", false
+		}
+
+		u, err := base.Parse(strings.TrimSpace(href))
+		if err != nil || !sameOrigin(u, req.URL) {
+			return "", false
+		}
+
+		l, err := canonical(u, c.keepQuery)
+		return l, err == nil && l != link && l != self
+	}, func(t html.Token) {
+		if t.Data != "base" {
+			return
+		}
+		if href, ok := attr(t, "href"); ok {
+			if u, err := final.Parse(href); err == nil {
+				base = u
+			}
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to read response: %s", err)
+	}
+
+	for l := range anchors {
+		page.Links[l] = true
+	}
+	page.Anchors = anchors
+	return page, nil
+}
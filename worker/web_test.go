@@ -0,0 +1,86 @@
+package worker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCanonicalURL(t *testing.T) {
+	for raw, expected := range map[string]string{
+		"HTTPS://Docs.Example.com:443":              "https://docs.example.com/",
+		"http://docs.example.com:8080/a/":           "http://docs.example.com:8080/a",
+		"https://docs.example.com/a/./b/../c#intro": "https://docs.example.com/a/c",
+		"https://docs.example.com/search?q=go&a=1":  "https://docs.example.com/search",
+	} {
+		c, err := CanonicalURL(raw, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c != expected {
+			t.Errorf("expect %s for %s. Got %s", expected, raw, c)
+		}
+	}
+
+	if c, _ := CanonicalURL("https://docs.example.com/search/?q=go&a=1", true); c != "https://docs.example.com/search?a=1&q=go" {
+		t.Errorf("expect sorted query. Got %s", c)
+	}
+
+	if _, err := CanonicalURL("mailto:docs@example.com", false); err == nil {
+		t.Error("expect an error for mailto url")
+	}
+}
+
+func TestWebCrawler(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/guide/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><body>
+<p>Read the <a href="install/">install guide</a> first.</p>
+<p>See <a href="../api/#types">API</a>, <a href="/api?page=2">more API</a> and <a href="#top">top</a>.</p>
+<p><a href="https://example.org/">elsewhere</a> <a href="https://127.0.0.1:443/guide/">other port</a> <a href="mailto:docs@example.com">mail</a></p>
+</body></html>`))
+	})
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/guide/", http.StatusMovedPermanently)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	start, _ := CanonicalURL(srv.URL+"/old", false)
+	page, err := NewWebCrawler(srv.Client(), false).Fetch(context.Background(), start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	anchors := map[string]Anchor{
+		srv.URL + "/guide/install": {Text: "install guide", Context: "Read the install guide first."},
+		srv.URL + "/api":           {Text: "API", Context: "See API, more API and top."},
+	}
+	if len(page.Links) != len(anchors) {
+		t.Fatalf("expect links %v. Got %v", anchors, page.Links)
+	}
+	for l, a := range anchors {
+		if page.Anchors[l] != a {
+			t.Fatalf("expect anchor %+v for %s. Got %+v", a, l, page.Anchors[l])
+		}
+	}
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<p><a href="/news">news</a> <a href="` + srv.URL + `/guide/install">back</a></p>`))
+	}))
+	defer other.Close()
+	mux.HandleFunc("/away", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, other.URL+"/", http.StatusFound)
+	})
+
+	start, _ = CanonicalURL(srv.URL+"/away", false)
+	page, err = NewWebCrawler(srv.Client(), false).Fetch(context.Background(), start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Links) != 1 || !page.Links[srv.URL+"/guide/install"] {
+		t.Fatalf("expect only the links of the start origin. Got %v", page.Links)
+	}
+}
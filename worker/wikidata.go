@@ -0,0 +1,226 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+func init() {
+	Register("wikidata", Factory{
+		Description: "races between Wikidata items (Q42 -> Q1), the links are item valued statements (wbgetentities)",
+		Options: []OptionSpec{
+			{
+				Name:        "host",
+				Type:        OptionString,
+				Default:     "www.wikidata.org",
+				Description: "host of the Wikibase site to crawl",
+			},
+			{
+				Name:        "language",
+				Type:        OptionString,
+				Default:     "en",
+				Description: "language of the property labels",
+			},
+		},
+		New: func(env Env, opts Options) WikiCrawler {
+			c := newWikidataCrawler(env.Client)
+			c.endpoint = withHost(c.endpoint, opts)
+			if lang := opts.String("language"); lang != "" {
+				c.language = lang
+			}
+			return c
+		},
+		Normalize: func(_ Options, id string) string {
+			return strings.ToUpper(strings.TrimSpace(id))
+		},
+	})
+}
+
+// NewWikidataCrawler returns a crawler of the Wikidata entity graph. The pages are items, e.g. Q42,
+// and the links are the items used as statement values. The anchors have the property of the
+// statement as Label, e.g. P31, and its label as Text, e.g. instance of.
+func NewWikidataCrawler(client *http.Client) WikiCrawler {
+	return newWikidataCrawler(client)
+}
+
+func newWikidataCrawler(client *http.Client) *wikidataCrawler {
+	return &wikidataCrawler{
+		client: client,
+		endpoint: url.URL{
+			Scheme: "https",
+			Host:   "www.wikidata.org",
+			Path:   "/w/api.php",
+		},
+		language: "en",
+	}
+}
+
+// wikidataCrawler is using wbgetentities API to get the item statements.
+type wikidataCrawler struct {
+	client *http.Client
+
+	endpoint url.URL
+	language string
+}
+
+// snak is a Wikibase statement value.
+type snak struct {
+	SnakType  string `json:"snaktype"`
+	DataValue struct {
+		Type  string `json:"type"`
+		Value struct {
+			EntityType string `json:"entity-type"`
+			ID         string `json:"id"`
+		} `json:"value"`
+	} `json:"datavalue"`
+}
+
+// entity is a Wikibase entity returned by wbgetentities.
+type entity struct {
+	ID      string  `json:"id"`
+	Missing *string `json:"missing"`
+	Labels  map[string]struct {
+		Value string `json:"value"`
+	} `json:"labels"`
+	Claims map[string][]struct {
+		MainSnak snak `json:"mainsnak"`
+	} `json:"claims"`
+}
+
+// getEntities calls wbgetentities for at most 50 ids.
+func (c *wikidataCrawler) getEntities(ctx context.Context, ids []string, props string) (map[string]entity, error) {
+	var r struct {
+		Entities map[string]entity `json:"entities"`
+	}
+
+	v := url.Values{}
+	v.Set("action", "wbgetentities")
+	v.Set("ids", strings.Join(ids, "|"))
+	v.Set("props", props)
+	v.Set("languages", c.language)
+	if err := queryAPI(ctx, c.client, c.endpoint, v, &r); err != nil {
+		return nil, err
+	}
+	return r.Entities, nil
+}
+
+// ErrNoEntity is returned for an item which does not exist.
+var ErrNoEntity = errors.New("entity does not exist")
+
+// Fetch returns an item with links to the items used in its statements.
+func (c *wikidataCrawler) Fetch(ctx context.Context, link string) (*Page, error) {
+	if _, ok := AsOf(ctx); ok {
+		return nil, ErrAsOfUnsupported
+	}
+
+	entities, err := c.getEntities(ctx, []string{link}, "claims")
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{
+		Name:    link,
+		Links:   make(map[string]bool),
+		Anchors: make(map[string]Anchor),
+	}
+
+	e, ok := entities[link]
+	if !ok || e.Missing != nil {
+		return nil, ErrNoEntity
+	}
+
+	// the same item can be a value of several statements, label the link with the lowest property.
+	properties := make([]string, 0, len(e.Claims))
+	for p := range e.Claims {
+		properties = append(properties, p)
+	}
+	sort.Slice(properties, func(i, j int) bool {
+		return propertyLess(properties[i], properties[j])
+	})
+
+	var used []string
+	for _, p := range properties {
+		for _, claim := range e.Claims[p] {
+			s := claim.MainSnak
+			if s.SnakType != "value" || s.DataValue.Type != "wikibase-entityid" || s.DataValue.Value.EntityType != "item" {
+				continue
+			}
+
+			id := s.DataValue.Value.ID
+			if id == "" || page.Links[id] {
+				continue
+			}
+			page.Links[id] = true
+			page.Anchors[id] = Anchor{Label: p}
+			if len(used) == 0 || used[len(used)-1] != p {
+				used = append(used, p)
+			}
+		}
+	}
+
+	labels := c.propertyLabels(ctx, used)
+	for id, a := range page.Anchors {
+		a.Text = labels[a.Label]
+		page.Anchors[id] = a
+	}
+	return page, nil
+}
+
+// propertyLess orders property ids by number, e.g. P31 < P279.
+func propertyLess(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+// propertyLabelCache caches the property labels by host, language and property id. They rarely change.
+var propertyLabelCache = struct {
+	sync.Mutex
+	m map[string]string
+}{m: make(map[string]string)}
+
+// propertyLabels returns the labels of the properties. The properties without a label are
+// left out, a failed lookup is not an error since the labels are only descriptive.
+func (c *wikidataCrawler) propertyLabels(ctx context.Context, properties []string) map[string]string {
+	prefix := c.endpoint.Host + ":" + c.language + ":"
+	result := make(map[string]string, len(properties))
+
+	var missing []string
+	propertyLabelCache.Lock()
+	for _, p := range properties {
+		if l, ok := propertyLabelCache.m[prefix+p]; ok {
+			result[p] = l
+			continue
+		}
+		missing = append(missing, p)
+	}
+	propertyLabelCache.Unlock()
+
+	for len(missing) > 0 {
+		n := apiBatch
+		if n > len(missing) {
+			n = len(missing)
+		}
+
+		entities, err := c.getEntities(ctx, missing[:n], "labels")
+		if err != nil {
+			return result
+		}
+
+		propertyLabelCache.Lock()
+		for _, p := range missing[:n] {
+			l := entities[p].Labels[c.language].Value
+			propertyLabelCache.m[prefix+p] = l
+			result[p] = l
+		}
+		propertyLabelCache.Unlock()
+		missing = missing[n:]
+	}
+	return result
+}
@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestWikidataCrawler(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("action") != "wbgetentities" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+
+		switch q.Get("props") {
+		case "claims":
+			if q.Get("ids") == "Q404" {
+				w.Write([]byte(`{"entities":{"Q404":{"id":"Q404","missing":""}}}`))
+				return
+			}
+			w.Write([]byte(`{"entities":{"Q42":{"id":"Q42","claims":{
+				"P31":[{"mainsnak":{"snaktype":"value","datavalue":{"type":"wikibase-entityid","value":{"entity-type":"item","id":"Q5"}}}}],
+				"P27":[{"mainsnak":{"snaktype":"value","datavalue":{"type":"wikibase-entityid","value":{"entity-type":"item","id":"Q145"}}}}],
+				"P106":[{"mainsnak":{"snaktype":"value","datavalue":{"type":"wikibase-entityid","value":{"entity-type":"item","id":"Q5"}}}}],
+				"P569":[{"mainsnak":{"snaktype":"value","datavalue":{"type":"time","value":{}}}}],
+				"P1441":[{"mainsnak":{"snaktype":"novalue"}}]
+			}}}}`))
+		case "labels":
+			w.Write([]byte(`{"entities":{
+				"P27":{"id":"P27","labels":{"en":{"value":"country of citizenship"}}},
+				"P31":{"id":"P31","labels":{"en":{"value":"instance of"}}}
+			}}`))
+		}
+	}))
+	defer srv.Close()
+	target, _ := url.Parse(srv.URL)
+
+	c := NewWikidataCrawler(&http.Client{Transport: &rewriteTransport{target: target}})
+	page, err := c.Fetch(context.Background(), "Q42")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	anchors := map[string]Anchor{
+		"Q5":   {Text: "instance of", Label: "P31"},
+		"Q145": {Text: "country of citizenship", Label: "P27"},
+	}
+	if len(page.Links) != len(anchors) {
+		t.Fatalf("expect links %v. Got %v", anchors, page.Links)
+	}
+	for l, a := range anchors {
+		if page.Anchors[l] != a {
+			t.Fatalf("expect anchor %+v for %s. Got %+v", a, l, page.Anchors[l])
+		}
+	}
+
+	if _, err := c.Fetch(context.Background(), "Q404"); err != ErrNoEntity {
+		t.Fatalf("expect ErrNoEntity for a missing item. Got %v", err)
+	}
+}
@@ -5,14 +5,36 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/sirupsen/logrus"
 	"golang.org/x/net/html"
 )
 
+func init() {
+	Register("html", Factory{
+		Description: "parses the links from the rendered page html (/wiki/{title})",
+		Options:     []OptionSpec{hostOption},
+		New: func(env Env, opts Options) WikiCrawler {
+			c := newHTMLWikiCrawler(env.Client)
+			c.endpoint = withHost(c.endpoint, opts)
+			c.robots = newRobotsGuard(env)
+			return c
+		},
+		// the links are the hrefs, e.g. /wiki/Mike_Tyson -> Mike_Tyson.
+		Resolve: resolveWikiTitle(func(title string) string {
+			return strings.Replace(title, " ", "_", -1)
+		}),
+	})
+}
+
 // NewHTMLWikiCrawler returns a new wiki crawler that parses html.
 func NewHTMLWikiCrawler(client *http.Client) WikiCrawler {
+	return newHTMLWikiCrawler(client)
+}
+
+func newHTMLWikiCrawler(client *http.Client) *htmlWikiCrawler {
 	return &htmlWikiCrawler{
 		client: client,
 		endpoint: url.URL{
@@ -26,18 +48,46 @@ func NewHTMLWikiCrawler(client *http.Client) WikiCrawler {
 // htmlWikiCrawler parses wiki html page
 type htmlWikiCrawler struct {
 	client *http.Client
+	robots *robotsGuard
 
 	endpoint url.URL
 }
 
+// trim converts the href of a wiki link to a page name, e.g. /wiki/Mike_Tyson#Early_life -> Mike_Tyson.
 func (c *htmlWikiCrawler) trim(u string) string {
-	trimmed := strings.TrimLeft(u, "/wiki/")
-	if index := strings.Index(u, "#"); index > -1 {
-		trimmed = u[index:]
+	trimmed := strings.TrimPrefix(u, "/wiki/")
+	if index := strings.Index(trimmed, "#"); index > -1 {
+		trimmed = trimmed[:index]
+	}
+
+	if unescaped, err := url.PathUnescape(trimmed); err == nil {
+		trimmed = unescaped
 	}
 	return trimmed
 }
 
+// pageURL returns the url of the page html. If the context has a time set with WithAsOf
+// it is the url of the page revision which was current at that time.
+func (c *htmlWikiCrawler) pageURL(ctx context.Context, link string) (string, error) {
+	t, ok := AsOf(ctx)
+	if !ok {
+		return c.endpoint.String() + url.PathEscape(link), nil
+	}
+
+	revID, err := resolveRevision(ctx, c.client, apiEndpoint(c.endpoint), link, t)
+	if err != nil {
+		return "", err
+	}
+
+	u := url.URL{
+		Scheme:   c.endpoint.Scheme,
+		Host:     c.endpoint.Host,
+		Path:     "/w/index.php",
+		RawQuery: url.Values{"oldid": {strconv.FormatInt(revID, 10)}}.Encode(),
+	}
+	return u.String(), nil
+}
+
 // Fetch gets a link and returns a *Page which represents a page with found links.
 func (c *htmlWikiCrawler) Fetch(ctx context.Context, link string) (*Page, error) {
 	page := &Page{
@@ -45,7 +95,15 @@ func (c *htmlWikiCrawler) Fetch(ctx context.Context, link string) (*Page, error)
 		Links: make(map[string]bool),
 	}
 
-	pageURL := c.endpoint.String() + string(link)
+	pageURL, err := c.pageURL(ctx, link)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.robots.check(ctx, pageURL); err != nil {
+		return nil, err
+	}
+
 	req, err := http.NewRequest("GET", pageURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("unable to make a new request: %s", err)
@@ -59,39 +117,36 @@ func (c *htmlWikiCrawler) Fetch(ctx context.Context, link string) (*Page, error)
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("bad response: %d", resp.StatusCode)
+		return nil, &StatusError{Code: resp.StatusCode}
 	}
 
-	z := html.NewTokenizer(resp.Body)
-	for {
-		tt := z.Next()
-
-		switch {
-		case tt == html.ErrorToken:
-			return page, nil
-		case tt == html.StartTagToken:
-			t := z.Token()
-
-			isAnchor := t.Data == "a"
-			if !isAnchor {
-				continue
-			}
-
-			for _, a := range t.Attr {
-				if a.Key == "href" {
-					if !strings.HasPrefix(a.Val, "/wiki/") {
-						continue
-					}
-					if strings.Contains(a.Val, ":") {
-						continue
-					}
-
-					l := c.trim(a.Val)
-					if _, ok := page.Links[l]; !ok {
-						page.Links[l] = true
-					}
-				}
-			}
+	anchors, err := extractLinks(resp.Body, func(t html.Token) (string, bool) {
+		href, _ := attr(t, "href")
+		if !strings.HasPrefix(href, "/wiki/") {
+			return "", false
 		}
+
+		l := c.trim(href)
+		return l, l != "" && IsArticle(l)
+	}, func(t html.Token) {
+		if isDisambiguationBox(t) {
+			page.Disambiguation = true
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to read response: %s", err)
 	}
+
+	for l := range anchors {
+		page.Links[l] = true
+	}
+	page.Anchors = anchors
+	return page, nil
+}
+
+// isDisambiguationBox returns true if the token is a disambiguation notice box
+// rendered by MediaWiki on disambiguation pages.
+func isDisambiguationBox(t html.Token) bool {
+	id, _ := attr(t, "id")
+	return id == "disambigbox" || hasValue(t, "class", "dmbox-disambig")
 }